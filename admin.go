@@ -0,0 +1,86 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "errors"
+    "flag"
+    "fmt"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/Fipaan/gosp/server"
+    "github.com/Fipaan/gosp/log"
+)
+
+// reads password for new admin from GOSP_ADMIN_PASSWORD or stdin
+func readAdminPassword() (string, error) {
+    if pass := os.Getenv("GOSP_ADMIN_PASSWORD"); pass != "" {
+        return pass, nil
+    }
+    log.Eprintf("Password: ")
+    line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+    if err != nil && line == "" {
+        return "", fmt.Errorf("couldn't read password: %w", err)
+    }
+    pass := strings.TrimRight(line, "\r\n")
+    if pass == "" { return "", errors.New("password is required") }
+    return pass, nil
+}
+
+func runAdmin(args []string) {
+    fs := flag.NewFlagSet("admin", flag.ExitOnError)
+    create := fs.Bool("create", false, "create user if it doesn't exist")
+    cfg := mustLoadConfig(fs, args)
+    if fs.NArg() != 1 {
+        usage()
+        log.Abortf("admin: expected exactly one username")
+    }
+    username := strings.TrimSpace(fs.Arg(0))
+
+    // errors are reported after storage is closed
+    if err := makeAdmin(&cfg, username, *create); err != nil {
+        log.Abortf("admin: %s", err.Error())
+    }
+    log.Infof("`%s` is admin now", username)
+}
+
+func makeAdmin(cfg *Config, username string, create bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+    db, closeFn := initDB(ctx, cfg)
+	defer func() {
+		cctx, ccancel := context.WithTimeout(context.Background(), time.Duration(cfg.DBTimeout))
+		defer ccancel()
+		if err := closeFn(cctx); err != nil {
+			log.Errorf("Couldn't close db: %s", err.Error())
+		}
+	}()
+
+    _, exists, err := db.GetUser(ctx, username)
+    if err != nil { return fmt.Errorf("couldn't get user: %w", err) }
+    if !exists {
+        if !create {
+            return fmt.Errorf("user `%s` doesn't exist, use -create to create it", username)
+        }
+        pass, err := readAdminPassword()
+        if err != nil { return err }
+        if err = db.CreateUser(ctx, username, pass); err != nil {
+            return fmt.Errorf("couldn't create user: %w", err)
+        }
+        log.Infof("Created user `%s`", username)
+    }
+
+    if _, err = db.SetUserRole(ctx, username, server.RoleAdmin); err != nil {
+        return fmt.Errorf("couldn't set role: %w", err)
+    }
+    err = db.AppendAudit(ctx, server.AuditDoc{
+        Event:   server.AuditAdminRole,
+        Target:  username,
+        Details: map[string]string{"role": server.RoleAdmin, "via": "cli"},
+    }, time.Duration(cfg.AuditRetention))
+    if err != nil { log.Errorf("Couldn't record audit event: %s", err.Error()) }
+    return nil
+}
@@ -0,0 +1,565 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "net"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "github.com/Fipaan/gosp/log"
+    "github.com/Fipaan/gosp/server"
+)
+
+type HTTPConfig struct {
+    ReadHeaderTimeout server.Duration `json:"readHeaderTimeout"`
+    ReadTimeout       server.Duration `json:"readTimeout"`
+    WriteTimeout      server.Duration `json:"writeTimeout"`
+    IdleTimeout       server.Duration `json:"idleTimeout"`
+    MaxHeaderBytes    int             `json:"maxHeaderBytes"`
+    ShutdownTimeout   server.Duration `json:"shutdownTimeout"`
+    // time /readyz reports not ready before listener is closed,
+    // so load balancer can stop sending requests
+    DrainDelay        server.Duration `json:"drainDelay"`
+}
+
+type TLSConfig struct {
+    CertFile   string          `json:"certFile"`
+    KeyFile    string          `json:"keyFile"`
+    SelfSigned bool            `json:"selfSigned"` // generated certificate, for development
+    HSTSMaxAge server.Duration `json:"hstsMaxAge"` // zero disables
+}
+
+type Config struct {
+    Addr         string          `json:"addr"`
+    CookieName   string          `json:"cookieName"`
+    AuthTTL      server.Duration `json:"authTTL"`
+    MaxBodyBytes int64           `json:"maxBodyBytes"`
+    DBTimeout    server.Duration `json:"dbTimeout"`
+    EvalTimeout  server.Duration `json:"evalTimeout"` // zero disables
+    PublicDir    string          `json:"publicDir"` // empty serves embedded UI
+
+    AuditRetention server.Duration `json:"auditRetention"` // zero keeps audit events forever
+
+    LogFormat     string `json:"logFormat"`     // text or json
+    LogLevel      string `json:"logLevel"`      // debug, info, warn or error
+    LogFile       string `json:"logFile"`       // stdout and stderr when empty
+    LogMaxSize    int64  `json:"logMaxSize"`    // bytes before logFile is rotated, 0 disables
+    LogMaxBackups int    `json:"logMaxBackups"` // rotated files kept
+
+    HTTP HTTPConfig `json:"http"`
+    TLS  TLSConfig  `json:"tls"`
+
+    CORSOrigins []string `json:"corsOrigins"` // "*" allows any origin without credentials
+    TrustProxy  bool     `json:"trustProxy"`  // trust X-Forwarded-Proto/-For of reverse proxy
+
+    MongoURI   string `json:"mongoURI"`
+    MongoDB    string `json:"mongoDB"`
+    AuthSecret string `json:"authSecret"`
+
+    Limits server.RateLimits `json:"limits"`
+}
+
+func DefaultConfig() Config {
+    return Config{
+        Addr:         ":8000",
+        CookieName:   "authKey",
+        AuthTTL:      server.Duration(30 * 24 * time.Hour),
+        MaxBodyBytes: 1 << 20,
+        DBTimeout:    server.Duration(5 * time.Second),
+        EvalTimeout:  server.Duration(10 * time.Second),
+        AuditRetention: server.Duration(365 * 24 * time.Hour),
+        LogFormat:    "text",
+        LogLevel:     "info",
+        LogMaxSize:   100 << 20,
+        LogMaxBackups: 5,
+        HTTP: HTTPConfig{
+            ReadHeaderTimeout: server.Duration(5 * time.Second),
+            ReadTimeout:       server.Duration(15 * time.Second),
+            WriteTimeout:      server.Duration(30 * time.Second),
+            IdleTimeout:       server.Duration(2 * time.Minute),
+            MaxHeaderBytes:    64 << 10,
+            ShutdownTimeout:   server.Duration(15 * time.Second),
+        },
+        TLS: TLSConfig{
+            HSTSMaxAge: server.Duration(180 * 24 * time.Hour),
+        },
+        Limits:       server.DefaultRateLimits(),
+    }
+}
+
+// option settable both by flag and by environment variable
+type option struct {
+    flag  string
+    env   string
+    usage string
+    set   func(cfg *Config, val string) error
+}
+
+// flags of boolean options, they can be given without value
+var boolFlags = map[string]bool{}
+
+func setDuration(field func(*Config) *server.Duration) func(*Config, string) error {
+    return func(c *Config, val string) error { return field(c).UnmarshalText([]byte(val)) }
+}
+
+func boolOption(flag, env, usage string, field func(*Config) *bool) option {
+    boolFlags[flag] = true
+    return option{flag, env, usage, func(c *Config, val string) (err error) {
+        *field(c), err = strconv.ParseBool(val)
+        return
+    }}
+}
+
+func configOptions() []option {
+    return []option{
+        {"addr", "GOSP_ADDR", "listen address",
+            func(c *Config, v string) error { c.Addr = v; return nil }},
+        {"cookie-name", "GOSP_COOKIE_NAME", "name of auth cookie",
+            func(c *Config, v string) error { c.CookieName = v; return nil }},
+        {"auth-ttl", "GOSP_AUTH_TTL", "lifetime of login session",
+            setDuration(func(c *Config) *server.Duration { return &c.AuthTTL })},
+        {"max-body-bytes", "GOSP_MAX_BODY_BYTES", "max size of request body",
+            func(c *Config, v string) (err error) {
+                c.MaxBodyBytes, err = strconv.ParseInt(v, 10, 64)
+                return
+            }},
+        {"db-timeout", "GOSP_DB_TIMEOUT", "timeout of storage requests",
+            setDuration(func(c *Config) *server.Duration { return &c.DBTimeout })},
+        {"eval-timeout", "GOSP_EVAL_TIMEOUT", "max duration of one evaluation, 0 disables",
+            setDuration(func(c *Config) *server.Duration { return &c.EvalTimeout })},
+        {"shutdown-timeout", "GOSP_SHUTDOWN_TIMEOUT", "time to finish running requests on shutdown",
+            setDuration(func(c *Config) *server.Duration { return &c.HTTP.ShutdownTimeout })},
+        {"drain-delay", "GOSP_DRAIN_DELAY", "time to report not ready before shutdown",
+            setDuration(func(c *Config) *server.Duration { return &c.HTTP.DrainDelay })},
+        {"audit-retention", "GOSP_AUDIT_RETENTION", "how long audit events are kept, 0 keeps them forever",
+            setDuration(func(c *Config) *server.Duration { return &c.AuditRetention })},
+        {"public-dir", "GOSP_PUBLIC_DIR", "serve UI from directory instead of embedded files (development)",
+            func(c *Config, v string) error { c.PublicDir = v; return nil }},
+        {"log-format", "GOSP_LOG_FORMAT", "format of log records: text or json",
+            func(c *Config, v string) error { c.LogFormat = v; return nil }},
+        {"log-level", "GOSP_LOG_LEVEL", "minimal level of log records: debug, info, warn or error",
+            func(c *Config, v string) error { c.LogLevel = v; return nil }},
+        {"log-file", "GOSP_LOG_FILE", "write log to file instead of stdout and stderr",
+            func(c *Config, v string) error { c.LogFile = v; return nil }},
+        {"log-max-size", "GOSP_LOG_MAX_SIZE", "size of log file in bytes before it is rotated, 0 disables",
+            func(c *Config, v string) (err error) {
+                c.LogMaxSize, err = strconv.ParseInt(v, 10, 64)
+                return
+            }},
+        {"log-max-backups", "GOSP_LOG_MAX_BACKUPS", "rotated log files kept",
+            func(c *Config, v string) (err error) {
+                c.LogMaxBackups, err = strconv.Atoi(v)
+                return
+            }},
+        {"tls-cert", "GOSP_TLS_CERT", "TLS certificate file",
+            func(c *Config, v string) error { c.TLS.CertFile = v; return nil }},
+        {"tls-key", "GOSP_TLS_KEY", "TLS key file",
+            func(c *Config, v string) error { c.TLS.KeyFile = v; return nil }},
+        boolOption("tls-self-signed", "GOSP_TLS_SELF_SIGNED", "serve TLS with generated certificate (development)",
+            func(c *Config) *bool { return &c.TLS.SelfSigned }),
+        {"cors-origins", "GOSP_CORS_ORIGINS", "comma-separated origins allowed to call API",
+            func(c *Config, v string) error {
+                c.CORSOrigins = nil
+                for _, o := range strings.Split(v, ",") {
+                    if o = strings.TrimSpace(o); o != "" {
+                        c.CORSOrigins = append(c.CORSOrigins, o)
+                    }
+                }
+                return nil
+            }},
+        boolOption("trust-proxy", "GOSP_TRUST_PROXY", "trust X-Forwarded-Proto and X-Forwarded-For headers of reverse proxy",
+            func(c *Config) *bool { return &c.TrustProxy }),
+        {"mongo-uri", "MONGO_URI", "MongoDB connection URI",
+            func(c *Config, v string) error { c.MongoURI = v; return nil }},
+        {"mongo-db", "MONGO_DB", "MongoDB database name",
+            func(c *Config, v string) error { c.MongoDB = v; return nil }},
+        {"auth-secret", "AUTH_HMAC_SECRET", "secret for auth keys and tokens",
+            func(c *Config, v string) error { c.AuthSecret = v; return nil }},
+    }
+}
+
+// Loads config: defaults < config file < environment < flags.
+// Registers flags on fs and parses args with it.
+func loadConfig(fs *flag.FlagSet, args []string) (cfg Config, printConfig bool, err error) {
+    cfg = DefaultConfig()
+    opts := configOptions()
+
+    var flagSets []func() error
+    for _, opt := range opts {
+        usage := fmt.Sprintf("%s (env %s)", opt.usage, opt.env)
+        deferSet := func(val string) error {
+            flagSets = append(flagSets, func() error {
+                if err := opt.set(&cfg, val); err != nil {
+                    return fmt.Errorf("-%s: %w", opt.flag, err)
+                }
+                return nil
+            })
+            return nil
+        }
+        if boolFlags[opt.flag] {
+            fs.Var(boolFlag(deferSet), opt.flag, usage)
+        } else {
+            fs.Func(opt.flag, usage, deferSet)
+        }
+    }
+    configPath := fs.String("config", os.Getenv("GOSP_CONFIG"),
+                            "path to config file, .json or .toml (env GOSP_CONFIG)")
+    fs.BoolVar(&printConfig, "print-config", false, "print effective config and exit")
+    if err = fs.Parse(args); err != nil { return }
+
+    if *configPath != "" {
+        if err = readConfigFile(*configPath, &cfg); err != nil { return }
+    }
+    for _, opt := range opts {
+        val := os.Getenv(opt.env)
+        if val == "" { continue }
+        if err = opt.set(&cfg, val); err != nil {
+            err = fmt.Errorf("%s: %w", opt.env, err)
+            return
+        }
+    }
+    for _, set := range flagSets {
+        if err = set(); err != nil { return }
+    }
+    return
+}
+
+// boolean flag which may be given without value, like flag.BoolFunc,
+// but with explicit value passed through (-flag=false)
+type boolFlag func(string) error
+
+func (f boolFlag) Set(val string) error { return f(val) }
+func (f boolFlag) String() string       { return "" }
+func (f boolFlag) IsBoolFlag() bool     { return true }
+
+func readConfigFile(path string, cfg *Config) error {
+    bytes, err := os.ReadFile(path)
+    if err != nil { return err }
+
+    if strings.EqualFold(filepath.Ext(path), ".toml") {
+        tree, err := parseTOML(string(bytes))
+        if err != nil { return fmt.Errorf("%s:%w", path, err) }
+        // TOML tree has the same shape as JSON config
+        if bytes, err = json.Marshal(tree); err != nil { return err }
+    }
+
+    dec := json.NewDecoder(strings.NewReader(string(bytes)))
+    dec.DisallowUnknownFields()
+    if err = dec.Decode(cfg); err != nil {
+        return fmt.Errorf("%s: %w", path, err)
+    }
+    return nil
+}
+
+func (cfg *Config) Validate() error {
+    var errs []error
+    check := func(ok bool, format string, args ...any) {
+        if !ok { errs = append(errs, fmt.Errorf(format, args...)) }
+    }
+
+    _, _, err := net.SplitHostPort(cfg.Addr)
+    check(err == nil, "addr: expected [host]:port, got %q", cfg.Addr)
+    check(cfg.CookieName != "" && !strings.ContainsAny(cfg.CookieName, " \t\r\n;,=\"()<>@:/[]?{}\\"),
+          "cookieName: %q is not a valid cookie name", cfg.CookieName)
+    check(cfg.AuthTTL > 0, "authTTL: must be positive, got %s", time.Duration(cfg.AuthTTL))
+    check(cfg.MaxBodyBytes > 0, "maxBodyBytes: must be positive, got %d", cfg.MaxBodyBytes)
+    check(cfg.DBTimeout > 0, "dbTimeout: must be positive, got %s", time.Duration(cfg.DBTimeout))
+    check(cfg.EvalTimeout >= 0, "evalTimeout: must not be negative, got %s", time.Duration(cfg.EvalTimeout))
+    check(cfg.AuditRetention >= 0, "auditRetention: must not be negative, got %s",
+          time.Duration(cfg.AuditRetention))
+
+    for name, d := range map[string]server.Duration{
+        "readHeaderTimeout": cfg.HTTP.ReadHeaderTimeout,
+        "readTimeout":       cfg.HTTP.ReadTimeout,
+        "writeTimeout":      cfg.HTTP.WriteTimeout,
+        "idleTimeout":       cfg.HTTP.IdleTimeout,
+        "shutdownTimeout":   cfg.HTTP.ShutdownTimeout,
+    } {
+        check(d > 0, "http.%s: must be positive, got %s", name, time.Duration(d))
+    }
+    check(cfg.HTTP.DrainDelay >= 0, "http.drainDelay: must not be negative, got %s",
+          time.Duration(cfg.HTTP.DrainDelay))
+    check(cfg.HTTP.MaxHeaderBytes >= 4 << 10, "http.maxHeaderBytes: must be at least 4096, got %d",
+          cfg.HTTP.MaxHeaderBytes)
+    check(cfg.EvalTimeout == 0 || cfg.EvalTimeout < cfg.HTTP.WriteTimeout,
+          "evalTimeout: must be less than http.writeTimeout, so result can be written")
+    check((cfg.TLS.CertFile == "") == (cfg.TLS.KeyFile == ""),
+          "tls: certFile and keyFile must be set together")
+    check(!cfg.TLS.SelfSigned || cfg.TLS.CertFile == "",
+          "tls: selfSigned can't be used with certFile")
+    check(cfg.TLS.HSTSMaxAge >= 0, "tls.hstsMaxAge: must not be negative, got %s",
+          time.Duration(cfg.TLS.HSTSMaxAge))
+    for _, origin := range cfg.CORSOrigins {
+        u, err := url.Parse(origin)
+        check(origin == "*" || (err == nil && u.Scheme != "" && u.Host != "" &&
+                                origin == u.Scheme + "://" + u.Host),
+              "corsOrigins: %q is not an origin, expected scheme://host[:port]", origin)
+    }
+    _, err = log.ParseFormat(cfg.LogFormat)
+    check(err == nil, "logFormat: expected text or json, got %q", cfg.LogFormat)
+    _, err = log.ParseLevel(cfg.LogLevel)
+    check(err == nil, "logLevel: expected debug, info, warn or error, got %q", cfg.LogLevel)
+    check(cfg.LogMaxSize >= 0, "logMaxSize: must not be negative, got %d", cfg.LogMaxSize)
+    check(cfg.LogMaxBackups >= 0, "logMaxBackups: must not be negative, got %d", cfg.LogMaxBackups)
+    if cfg.PublicDir != "" {
+        if st, err := os.Stat(cfg.PublicDir); err != nil {
+            check(false, "publicDir: %s", err)
+        } else {
+            check(st.IsDir(), "publicDir: %s is not a directory", cfg.PublicDir)
+        }
+    }
+
+    check(cfg.MongoURI   != "", "mongoURI: required (set MONGO_URI or -mongo-uri)")
+    check(cfg.MongoDB    != "", "mongoDB: required (set MONGO_DB or -mongo-db)")
+    check(cfg.AuthSecret != "", "authSecret: required (set AUTH_HMAC_SECRET or -auth-secret)")
+
+    lim := &cfg.Limits
+    for name, l := range map[string]server.RateLimit{
+        "loginIP":    lim.LoginIP,
+        "loginUser":  lim.LoginUser,
+        "registerIP": lim.RegisterIP,
+        "exprIP":     lim.ExprIP,
+        "exprUser":   lim.ExprUser,
+    } {
+        check(l.Rate >= 0 && l.Burst >= 0, "limits.%s: rate and burst must not be negative", name)
+        check(l.Rate == 0 || l.Burst >= 1, "limits.%s: burst must be at least 1", name)
+    }
+    check(lim.MaxFailedLogins >= 0, "limits.maxFailedLogins: must not be negative")
+    check(lim.MaxFailedLogins == 0 || lim.LockoutTime > 0,
+          "limits.lockoutTime: must be positive when lockout is enabled")
+
+    return errors.Join(errs...)
+}
+
+// prints config as JSON, with secrets hidden
+func (cfg Config) Print() {
+    if cfg.AuthSecret != "" { cfg.AuthSecret = "<hidden>" }
+    if cfg.MongoURI   != "" { cfg.MongoURI   = redactURI(cfg.MongoURI) }
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetEscapeHTML(false)
+    enc.SetIndent("", "    ")
+    enc.Encode(cfg)
+}
+
+// hides password of user:password@host
+func redactURI(uri string) string {
+    scheme, rest, ok := strings.Cut(uri, "://")
+    if !ok { return uri }
+    creds, host, ok := strings.Cut(rest, "@")
+    if !ok { return uri }
+    user, _, hasPass := strings.Cut(creds, ":")
+    if !hasPass { return uri }
+    return scheme + "://" + user + ":<hidden>@" + host
+}
+
+// TOML files are parsed without dependencies, so only part of TOML is supported
+const tomlSubset = "supported TOML subset: [tables] and [dotted.tables], " +
+    "key = value with \"basic\" or 'literal' strings, integers, floats, booleans " +
+    "and arrays of them, which may span lines, # comments"
+
+func unsupportedTOML(what string) error {
+    return fmt.Errorf("%s are not supported (%s)", what, tomlSubset)
+}
+
+// Parses subset of TOML, see tomlSubset.
+func parseTOML(text string) (map[string]any, error) {
+    root  := map[string]any{}
+    table := root
+    lines := strings.Split(text, "\n")
+    for i := 0; i < len(lines); i++ {
+        lineNo := i + 1
+        line := strings.TrimSpace(stripTOMLComment(lines[i]))
+        if line == "" { continue }
+
+        if strings.HasPrefix(line, "[[") {
+            return nil, fmt.Errorf("%d: %w", lineNo, unsupportedTOML("arrays of tables"))
+        }
+        if strings.HasPrefix(line, "[") {
+            if !strings.HasSuffix(line, "]") {
+                return nil, fmt.Errorf("%d: unclosed table header", lineNo)
+            }
+            table = root
+            for _, key := range strings.Split(line[1:len(line)-1], ".") {
+                key = strings.TrimSpace(key)
+                if key == "" { return nil, fmt.Errorf("%d: empty table name", lineNo) }
+                sub, ok := table[key].(map[string]any)
+                if !ok {
+                    if _, exists := table[key]; exists {
+                        return nil, fmt.Errorf("%d: `%s` is not a table", lineNo, key)
+                    }
+                    sub = map[string]any{}
+                    table[key] = sub
+                }
+                table = sub
+            }
+            continue
+        }
+
+        key, val, ok := strings.Cut(line, "=")
+        if !ok { return nil, fmt.Errorf("%d: expected key = value", lineNo) }
+        key = strings.TrimSpace(key)
+        val = strings.TrimSpace(val)
+        if key == "" { return nil, fmt.Errorf("%d: empty key", lineNo) }
+        if _, exists := table[key]; exists {
+            return nil, fmt.Errorf("%d: duplicate key `%s`", lineNo, key)
+        }
+
+        // array goes on until its closing bracket
+        for strings.HasPrefix(val, "[") && tomlArrayOpen(val) {
+            if i + 1 >= len(lines) {
+                return nil, fmt.Errorf("%d: unclosed array", lineNo)
+            }
+            i += 1
+            val += " " + strings.TrimSpace(stripTOMLComment(lines[i]))
+        }
+
+        v, err := parseTOMLValue(val)
+        if err != nil { return nil, fmt.Errorf("%d: %w", lineNo, err) }
+        table[key] = v
+    }
+    return root, nil
+}
+
+func parseTOMLValue(val string) (any, error) {
+    switch {
+    case strings.HasPrefix(val, "["):
+        if !strings.HasSuffix(val, "]") {
+            return nil, fmt.Errorf("unclosed array %s", val)
+        }
+        items := []any{}
+        for _, item := range splitTOMLArray(val[1:len(val)-1]) {
+            item = strings.TrimSpace(item)
+            if item == "" { continue } // trailing comma
+            if strings.HasPrefix(item, "[") {
+                return nil, unsupportedTOML("nested arrays")
+            }
+            v, err := parseTOMLValue(item)
+            if err != nil { return nil, err }
+            items = append(items, v)
+        }
+        return items, nil
+    case strings.HasPrefix(val, "{"):
+        return nil, unsupportedTOML("inline tables")
+    case strings.HasPrefix(val, `"""`) || strings.HasPrefix(val, "'''"):
+        return nil, unsupportedTOML("multi-line strings")
+    case strings.HasPrefix(val, "\""):
+        return unquoteTOML(val)
+    case strings.HasPrefix(val, "'"):
+        // literal string, backslashes are kept as is
+        if len(val) < 2 || !strings.HasSuffix(val, "'") || strings.Contains(val[1:len(val)-1], "'") {
+            return nil, fmt.Errorf("invalid string %s", val)
+        }
+        return val[1:len(val)-1], nil
+    case val == "true" || val == "false":
+        return val == "true", nil
+    }
+    num := strings.ReplaceAll(val, "_", "")
+    if n, err := strconv.ParseInt(num, 10, 64); err == nil {
+        return n, nil
+    }
+    if f, err := strconv.ParseFloat(num, 64); err == nil {
+        return f, nil
+    }
+    return nil, fmt.Errorf("unsupported value %s (%s)", val, tomlSubset)
+}
+
+// decodes "basic" string, its escapes differ from Go ones
+func unquoteTOML(val string) (string, error) {
+    var b strings.Builder
+    chars := []rune(val)
+    for i := 1; i < len(chars); i++ {
+        ch := chars[i]
+        switch {
+        case ch == '"':
+            if i != len(chars) - 1 { return "", fmt.Errorf("unexpected text after string %s", val) }
+            return b.String(), nil
+        case ch == '\\':
+            if i + 1 >= len(chars) { break }
+            i += 1
+            switch chars[i] {
+            case 'b':  b.WriteRune('\b')
+            case 't':  b.WriteRune('\t')
+            case 'n':  b.WriteRune('\n')
+            case 'f':  b.WriteRune('\f')
+            case 'r':  b.WriteRune('\r')
+            case '"':  b.WriteRune('"')
+            case '\\': b.WriteRune('\\')
+            case 'u', 'U':
+                n := 4
+                if chars[i] == 'U' { n = 8 }
+                if i + n >= len(chars) { return "", fmt.Errorf("invalid escape in string %s", val) }
+                code, err := strconv.ParseUint(string(chars[i+1:i+1+n]), 16, 32)
+                if err != nil || !utf8.ValidRune(rune(code)) {
+                    return "", fmt.Errorf("invalid escape in string %s", val)
+                }
+                b.WriteRune(rune(code))
+                i += n
+            default:
+                return "", fmt.Errorf("invalid escape \\%c in string %s", chars[i], val)
+            }
+        case ch < ' ' && ch != '\t' || ch == 0x7f:
+            return "", fmt.Errorf("control character in string %s", val)
+        default:
+            b.WriteRune(ch)
+        }
+    }
+    return "", fmt.Errorf("unclosed string %s", val)
+}
+
+// calls fn for characters outside of strings until it returns false
+func scanTOML(text string, fn func(i int, ch rune) bool) {
+    var quote rune
+    escaping := false
+    for i, ch := range text {
+        switch {
+        case escaping:                  escaping = false
+        case quote == '"' && ch == '\\':  escaping = true
+        case quote != 0:                if ch == quote { quote = 0 }
+        case ch == '"' || ch == '\'':   quote = ch
+        default:
+            if !fn(i, ch) { return }
+        }
+    }
+}
+
+// splits by commas outside of strings
+func splitTOMLArray(text string) (items []string) {
+    start := 0
+    scanTOML(text, func(i int, ch rune) bool {
+        if ch == ',' {
+            items = append(items, text[start:i])
+            start = i + 1
+        }
+        return true
+    })
+    return append(items, text[start:])
+}
+
+func tomlArrayOpen(text string) bool {
+    depth := 0
+    scanTOML(text, func(_ int, ch rune) bool {
+        switch ch {
+        case '[': depth += 1
+        case ']': depth -= 1
+        }
+        return true
+    })
+    return depth > 0
+}
+
+func stripTOMLComment(line string) string {
+    end := len(line)
+    scanTOML(line, func(i int, ch rune) bool {
+        if ch == '#' { end = i }
+        return ch != '#'
+    })
+    return line[:end]
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestParseTOML(t *testing.T) {
+    tests := []struct {
+        name string
+        text string
+        want map[string]any
+    }{
+        {"empty", "", map[string]any{}},
+        {"comments and blank lines", "# only comment\n\n  # indented\n", map[string]any{}},
+        {"values", `
+int = 42
+negative = -7
+grouped = 1_000_000
+float = 1.5
+exp = 2e3
+yes = true
+no = false
+basic = "a b" # comment
+literal = 'C:\logs\gosp.log'
+`, map[string]any{
+            "int": int64(42), "negative": int64(-7), "grouped": int64(1000000),
+            "float": 1.5, "exp": 2000.0, "yes": true, "no": false,
+            "basic": "a b", "literal": `C:\logs\gosp.log`,
+        }},
+        {"escapes", `s = "tab\tquote\" back\\ nl\n \u00e9 \U0001F600 # not comment"`, map[string]any{
+            "s": "tab\tquote\" back\\ nl\n é 😀 # not comment",
+        }},
+        {"arrays", `
+empty = []
+one = ["a"]
+mixed = [1, "two", 'three', true,]
+hash = ["#", ',']
+`, map[string]any{
+            "empty": []any{}, "one": []any{"a"},
+            "mixed": []any{int64(1), "two", "three", true},
+            "hash":  []any{"#", ","},
+        }},
+        {"multi-line array", `
+origins = [
+    "https://a.example", # first
+    'https://b.example',
+]
+after = 1
+`, map[string]any{
+            "origins": []any{"https://a.example", "https://b.example"},
+            "after":   int64(1),
+        }},
+        {"tables", `
+top = "x"
+[limits]
+persistent = true
+[limits.loginIP]
+rate = 0.5
+[ limits . exprIP ]
+burst = 3
+`, map[string]any{
+            "top": "x",
+            "limits": map[string]any{
+                "persistent": true,
+                "loginIP":    map[string]any{"rate": 0.5},
+                "exprIP":     map[string]any{"burst": int64(3)},
+            },
+        }},
+    }
+    for _, tt := range tests {
+        got, err := parseTOML(tt.text)
+        if err != nil {
+            t.Errorf("%s: %s", tt.name, err)
+            continue
+        }
+        if !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%s:\ngot  %#v\nwant %#v", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+    tests := []struct {
+        text string
+        err  string // prefix of error
+    }{
+        {"a = 1\nb", "2: expected key = value"},
+        {"= 1", "1: empty key"},
+        {"a = 1\na = 2", "2: duplicate key `a`"},
+        {"[t\n", "1: unclosed table header"},
+        {"[a..b]", "1: empty table name"},
+        {"a = 1\n[a]", "2: `a` is not a table"},
+        {"x = [1,\n2", "1: unclosed array"},
+        {"\n\nx = [1,\n2\ny = 3", "3: unclosed array"},
+        {"x = nope", "1: unsupported value nope (supported TOML subset"},
+        {"x = 1979-05-27", "1: unsupported value"},
+        {"x = {a = 1}", "1: inline tables are not supported (supported TOML subset"},
+        {"[[servers]]", "1: arrays of tables are not supported"},
+        {"x = [[1], [2]]", "1: nested arrays are not supported"},
+        {`x = """a"""`, "1: multi-line strings are not supported"},
+        {"x = '''a'''", "1: multi-line strings are not supported"},
+        {"x = 'a'b'", "1: invalid string"},
+        {`x = "a"b"`, "1: unexpected text after string"},
+        {`x = "unclosed`, "1: unclosed string"},
+        {`x = "\x41"`, `1: invalid escape \x`},
+        {`x = "\a"`, `1: invalid escape \a`},
+        {`x = "\'"`, `1: invalid escape \'`},
+        {`x = "\u12"`, "1: invalid escape"},
+        {`x = "\uD800"`, "1: invalid escape"},
+        {"x = \"a\x01\"", "1: control character"},
+    }
+    for _, tt := range tests {
+        _, err := parseTOML(tt.text)
+        if err == nil {
+            t.Errorf("%q: expected error %q", tt.text, tt.err)
+            continue
+        }
+        if !strings.HasPrefix(err.Error(), tt.err) {
+            t.Errorf("%q: got error %q, want %q", tt.text, err, tt.err)
+        }
+    }
+}
+
+func TestReadConfigFileTOML(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "gosp.toml")
+    text := "trustProxy = true\ncorsOrigins = [\n  'https://a.example',\n]\n"
+    if err := os.WriteFile(path, []byte(text), 0644); err != nil { t.Fatal(err) }
+
+    var cfg Config
+    if err := readConfigFile(path, &cfg); err != nil { t.Fatal(err) }
+    if !cfg.TrustProxy || !reflect.DeepEqual(cfg.CORSOrigins, []string{"https://a.example"}) {
+        t.Errorf("unexpected config %+v", cfg)
+    }
+
+    if err := os.WriteFile(path, []byte("\nunknownOption = 1\n"), 0644); err != nil { t.Fatal(err) }
+    if err := readConfigFile(path, &cfg); err == nil {
+        t.Error("unknown option is accepted")
+    }
+}
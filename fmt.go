@@ -0,0 +1,72 @@
+package main
+
+import (
+    "flag"
+    "io"
+    "os"
+
+    "github.com/Fipaan/gosp/format"
+    "github.com/Fipaan/gosp/log"
+)
+
+// gosp fmt [-check] [-w] [files...], stdin is formatted to stdout without files.
+// Exit status is 1 when -check finds unformatted files, 2 on errors.
+func runFmt(args []string) {
+    fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+    check := fs.Bool("check", false, "list files whose formatting differs, don't print or write them")
+    write := fs.Bool("w", false, "write result back to files instead of stdout")
+    width := fs.Int("width", format.DefaultWidth, "maximum line width")
+    fs.Parse(args)
+    opts := format.Options{Width: *width}
+
+    if fs.NArg() == 0 {
+        src, err := io.ReadAll(os.Stdin)
+        if err != nil { log.Abortf("fmt: %s", err.Error()) }
+        res, err := format.Source("<stdin>", string(src), opts)
+        if err != nil {
+            log.Errorf("%s", err.Error())
+            os.Exit(2)
+        }
+        if *check {
+            if res != string(src) {
+                log.Printf("<stdin>\n")
+                os.Exit(1)
+            }
+            return
+        }
+        os.Stdout.WriteString(res)
+        return
+    }
+
+    status := 0
+    for _, name := range fs.Args() {
+        src, err := os.ReadFile(name)
+        if err != nil {
+            log.Errorf("%s", err.Error())
+            status = 2
+            continue
+        }
+        res, err := format.Source(name, string(src), opts)
+        if err != nil {
+            log.Errorf("%s", err.Error())
+            status = 2
+            continue
+        }
+        switch {
+        case *check:
+            if res != string(src) {
+                log.Printf("%s\n", name)
+                if status == 0 { status = 1 }
+            }
+        case *write:
+            if res == string(src) { continue }
+            if err = os.WriteFile(name, []byte(res), 0644); err != nil {
+                log.Errorf("%s", err.Error())
+                status = 2
+            }
+        default:
+            os.Stdout.WriteString(res)
+        }
+    }
+    os.Exit(status)
+}
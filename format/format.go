@@ -0,0 +1,279 @@
+package format
+
+import (
+    "strings"
+    "unicode/utf8"
+
+    "github.com/Fipaan/gosp/lexer"
+)
+
+const (
+    DefaultWidth  = 80
+    DefaultIndent = 2
+)
+
+type Options struct {
+    Width  int // maximum line width, DefaultWidth when <= 0
+    Indent int // body indentation of special forms, DefaultIndent when <= 0
+}
+
+// error with location of offending token
+type Error struct {
+    Loc lexer.Location
+    Msg string
+}
+
+func (e *Error) Error() string {
+    return e.Loc.Loc() + ": " + e.Msg
+}
+
+type nodeKind uint8
+const (
+    nodeAtom nodeKind = iota
+    nodeList
+    nodeComment
+)
+
+type node struct {
+    kind     nodeKind
+    text     string // atom or comment text, opening bracket of list
+    close    string
+    children []*node
+
+    blankBefore bool // at least one empty line before node in source
+    trailing    bool // comment on the same line as previous token
+}
+
+// forms with leading arguments kept on the first line, rest is body
+var bodyForms = map[string]int{
+    "let":   2,
+    "defun": 2,
+}
+
+// Re-prints gosp source with canonical layout, comments are kept.
+// Source is only tokenized, so it does not have to evaluate.
+func Source(name, src string, opts Options) (string, error) {
+    if opts.Width  <= 0 { opts.Width  = DefaultWidth }
+    if opts.Indent <= 0 { opts.Indent = DefaultIndent }
+
+    nodes, err := tokenize(name, src)
+    if err != nil { return "", err }
+
+    p := printer{opts: opts}
+    for i, n := range nodes {
+        if i > 0 {
+            if n.kind == nodeComment && n.trailing {
+                p.WriteString(" ")
+                p.WriteString(n.text)
+                continue
+            }
+            p.newline(0)
+            if n.blankBefore { p.newline(0) }
+        }
+        p.node(n, 0)
+    }
+    if len(nodes) > 0 { p.WriteString("\n") }
+    return p.String(), nil
+}
+
+func tokenize(name, src string) ([]*node, error) {
+    l := lexer.LexerInit()
+    l.KeepComments = true
+    l.AddSourceNamed(name, src)
+
+    root  := &node{kind: nodeList}
+    stack := []*node{root}
+    var opens []lexer.Location
+    prevLine := 0
+    for {
+        if l.SkipSpaces(true) != lexer.ReadOk { break }
+        start := l.Cursor
+        if !l.ParseToken() { break }
+        if l.Type == lexer.TokenError {
+            return nil, &Error{Loc: l.ErrLoc, Msg: l.Err.Error()}
+        }
+
+        n := &node{kind: nodeAtom, text: l.TokenStr(start, l.Cursor)}
+        n.blankBefore = prevLine > 0 && start.Line > prevLine + 1
+        top := stack[len(stack)-1]
+        switch l.Type {
+        case lexer.TokenOParen, lexer.TokenOBracket, lexer.TokenOCurly:
+            n.kind  = nodeList
+            n.close = l.Type.OToC().Str()
+            top.children = append(top.children, n)
+            stack = append(stack, n)
+            opens = append(opens, start)
+        case lexer.TokenCParen, lexer.TokenCBracket, lexer.TokenCCurly:
+            if len(stack) == 1 || top.close != l.Type.Str() {
+                return nil, &Error{Loc: start, Msg: "unexpected " + l.Type.Str()}
+            }
+            stack = stack[:len(stack)-1]
+            opens = opens[:len(opens)-1]
+        case lexer.TokenComment:
+            n.kind     = nodeComment
+            n.text     = strings.TrimRight(n.text, " \t\r")
+            n.trailing = prevLine == start.Line
+            top.children = append(top.children, n)
+        default:
+            top.children = append(top.children, n)
+        }
+        prevLine = l.Cursor.Line
+    }
+    if len(opens) > 0 {
+        open := opens[len(opens)-1]
+        return nil, &Error{Loc: open, Msg: "unclosed " + stack[len(stack)-1].text}
+    }
+    return root.children, nil
+}
+
+type printer struct {
+    strings.Builder
+    opts Options
+    col  int // column of the next character, from 0
+}
+
+func (p *printer) WriteString(s string) (int, error) {
+    if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+        p.col = utf8.RuneCountInString(s[i+1:])
+    } else {
+        p.col += utf8.RuneCountInString(s)
+    }
+    return p.Builder.WriteString(s)
+}
+
+func (p *printer) newline(indent int) {
+    p.WriteString("\n")
+    p.WriteString(strings.Repeat(" ", indent))
+}
+
+// single-line form of n, ok is false when n cannot be on one line
+func flat(n *node) (s string, ok bool) {
+    switch n.kind {
+    case nodeAtom:    return n.text, true
+    case nodeComment: return "", false
+    }
+    parts := make([]string, 0, len(n.children))
+    for _, c := range n.children {
+        cs, ok := flat(c)
+        if !ok { return "", false }
+        parts = append(parts, cs)
+    }
+    return n.text + strings.Join(parts, " ") + n.close, true
+}
+
+func (p *printer) fits(s string) bool {
+    return p.col + utf8.RuneCountInString(s) <= p.opts.Width
+}
+
+// prints n starting at current column, indent is the column of n itself
+func (p *printer) node(n *node, indent int) {
+    if s, ok := flat(n); ok && p.fits(s) {
+        p.WriteString(s)
+        return
+    }
+    switch n.kind {
+    case nodeAtom, nodeComment:
+        p.WriteString(n.text)
+        return
+    }
+    if n.text == "(" {
+        p.call(n, indent)
+    } else {
+        p.fill(n, indent)
+    }
+}
+
+// prints children starting at i, each on its own line at indent
+func (p *printer) lines(children []*node, i, indent int) {
+    for ; i < len(children); i++ {
+        c := children[i]
+        if c.kind == nodeComment && c.trailing {
+            p.WriteString(" ")
+            p.WriteString(c.text)
+            continue
+        }
+        p.newline(indent)
+        p.node(c, indent)
+    }
+}
+
+func (p *printer) closeList(n *node, indent int) {
+    if last := n.children; len(last) > 0 && last[len(last)-1].kind == nodeComment {
+        p.newline(indent)
+    }
+    p.WriteString(n.close)
+}
+
+// (head a b
+//       c d)  for calls, or body indented for special forms
+func (p *printer) call(n *node, indent int) {
+    p.WriteString(n.text)
+    children := n.children
+    if len(children) == 0 || children[0].kind != nodeAtom {
+        p.lines(children, 0, indent + 1)
+        p.closeList(n, indent)
+        return
+    }
+    head := children[0]
+    p.WriteString(head.text)
+
+    if keep, ok := bodyForms[head.text]; ok {
+        i := 1
+        for ; i < len(children) && i <= keep && children[i].kind != nodeComment; i++ {
+            p.WriteString(" ")
+            c := children[i]
+            s, ok := flat(c)
+            // argument list of defun is packed like a list literal
+            if head.text == "defun" && i == 2 && c.kind == nodeList && !(ok && p.fits(s)) {
+                p.fill(c, p.col)
+            } else {
+                p.node(c, p.col)
+            }
+        }
+        p.lines(children, i, indent + p.opts.Indent)
+        p.closeList(n, indent)
+        return
+    }
+
+    if len(children) == 1 {
+        p.closeList(n, indent)
+        return
+    }
+    argCol := p.col + 1
+    if first := children[1]; first.kind != nodeComment && argCol < p.opts.Width / 2 {
+        p.WriteString(" ")
+        p.node(first, argCol)
+        p.lines(children, 2, argCol)
+    } else {
+        p.lines(children, 1, indent + p.opts.Indent)
+    }
+    p.closeList(n, indent)
+}
+
+// [a b c
+//  d e]  elements are packed into lines up to the width
+func (p *printer) fill(n *node, indent int) {
+    p.WriteString(n.text)
+    inner := indent + 1
+    for i, c := range n.children {
+        if c.kind == nodeComment {
+            if c.trailing {
+                p.WriteString(" ")
+            } else if i > 0 {
+                p.newline(inner)
+            }
+            p.WriteString(c.text)
+            continue
+        }
+        if i > 0 {
+            s, ok := flat(c)
+            if n.children[i-1].kind != nodeComment && ok && p.fits(" " + s) {
+                p.WriteString(" ")
+            } else {
+                p.newline(inner)
+            }
+        }
+        p.node(c, p.col)
+    }
+    p.closeList(n, indent)
+}
@@ -0,0 +1,56 @@
+package format
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/Fipaan/gosp/lexer"
+)
+
+var fuzzSeeds = []string{
+    "",
+    "(+ 1.0 2.0)",
+    "(defun norm (a double b double) \"Sum of squares\" (+ (sq a) (sq b)))",
+    "(let x 2.0 ; trailing\n  (* x x))\n\n\n; standalone\n(sq 3.0)",
+    "[[1.0 2.0] [3.0]] (map sq [1.0 2.0 3.0 4.0 5.0 6.0 7.0 8.0 9.0 10.0 11.0 12.0 13.0 14.0])",
+    "(deftest t (assert (< 1.0 2.0) \"msg\") (assert-equal [1.0] (pair 1.0)))",
+    "{} , \"str \\\" \\\\ \\n\" -7 .5 1. true",
+    "(+ 1.0 ( ] \"unclosed",
+}
+
+// tokens of source as text, comments without trailing spaces
+func tokens(src string) []string {
+    l := lexer.LexerInit()
+    l.KeepComments = true
+    l.AddSourceNamed("fuzz", src)
+    var toks []string
+    for {
+        if l.SkipSpaces(true) != lexer.ReadOk { break }
+        start := l.Cursor
+        if !l.ParseToken() { break }
+        toks = append(toks, strings.TrimRight(l.TokenStr(start, l.Cursor), " \t\r"))
+    }
+    return toks
+}
+
+// Formatted source must keep tokens in order and format to itself
+func FuzzSource(f *testing.F) {
+    for _, seed := range fuzzSeeds {
+        f.Add(seed, 0)
+    }
+    f.Fuzz(func(t *testing.T, src string, width int) {
+        width %= 200
+        out, err := Source("fuzz", src, Options{Width: width})
+        if err != nil { return }
+
+        want, got := tokens(src), tokens(out)
+        if strings.Join(got, "\x00") != strings.Join(want, "\x00") {
+            t.Fatalf("tokens changed\n--- source:\n%s\n--- formatted:\n%s", src, out)
+        }
+        again, err := Source("fuzz", out, Options{Width: width})
+        if err != nil { t.Fatalf("formatted source does not format: %s\n%s", err, out) }
+        if again != out {
+            t.Fatalf("formatting is not stable\n--- first:\n%s\n--- second:\n%s", out, again)
+        }
+    })
+}
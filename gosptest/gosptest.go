@@ -0,0 +1,192 @@
+package gosptest
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strings"
+    "time"
+
+    "github.com/Fipaan/gosp/lexer"
+    "github.com/Fipaan/gosp/parser"
+)
+
+type Options struct {
+    Run     *regexp.Regexp // only tests with matching names, all when nil
+    Timeout time.Duration  // per test, no limit when 0
+}
+
+type Failure struct {
+    Loc     lexer.Location `json:"loc"`
+    Message string         `json:"message"`
+}
+
+type Result struct {
+    Name       string         `json:"name"`
+    Loc        lexer.Location `json:"loc"`
+    Passed     bool           `json:"passed"`
+    Failure    *Failure       `json:"failure,omitempty"`
+    Duration   time.Duration  `json:"-"`
+    DurationMs float64        `json:"durationMs"`
+}
+
+type Report struct {
+    Results    []Result      `json:"results"`
+    Passed     int           `json:"passed"`
+    Failed     int           `json:"failed"`
+    Duration   time.Duration `json:"-"`
+    DurationMs float64       `json:"durationMs"`
+}
+
+type source struct {
+    name string
+    text string
+}
+
+// Collects *.gosp files, directories are walked recursively,
+// testdata and hidden directories are skipped like by go test
+func FindFiles(paths []string) ([]string, error) {
+    var files []string
+    for _, path := range paths {
+        info, err := os.Stat(path)
+        if err != nil { return nil, err }
+        if !info.IsDir() {
+            files = append(files, path)
+            continue
+        }
+        err = filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+            if err != nil { return err }
+            if d.IsDir() && name != path &&
+               (d.Name() == "testdata" || strings.HasPrefix(d.Name(), ".")) {
+                return filepath.SkipDir
+            }
+            if !d.IsDir() && strings.HasSuffix(name, ".gosp") {
+                files = append(files, name)
+            }
+            return nil
+        })
+        if err != nil { return nil, err }
+    }
+    return files, nil
+}
+
+func newParser(sources []source) parser.Parser {
+    p := parser.ParserInit()
+    for _, src := range sources {
+        p.AddSourceNamed(src.name, src.text)
+    }
+    return p
+}
+
+type loadError struct {
+    Loc lexer.Location
+    Msg string
+}
+
+func (e *loadError) Error() string {
+    return fmt.Sprintf("%s: %s", e.Loc.Loc(), e.Msg)
+}
+
+// Parses sources until n tests are defined, all of them when n <= 0.
+// Only defun and deftest have effect, other expressions are not evaluated.
+func load(sources []source, n int) (parser.GospState, error) {
+    gs := parser.GospInit()
+    p := newParser(sources)
+    for n <= 0 || len(gs.Tests) < n {
+        if p.SkipSpaces(true) != lexer.ReadOk { break }
+        start := p.Cursor
+        _, ok := p.ParseExpr(&gs)
+        if ok && (p.Cursor.Raw > start.Raw || p.Cursor.SourceIndex != start.SourceIndex) { continue }
+        msg := "syntax error"
+        if p.Err != nil { msg = p.Err.Error() }
+        return gs, &loadError{Loc: p.ErrLoc, Msg: msg}
+    }
+    return gs, nil
+}
+
+// Runs tests defined in files, each in a fresh GospState.
+// All files are loaded into one Lexer, so tests may use functions of
+// previously listed files.
+// File which can't be read or loaded is reported as failed entry
+// and left out, other files are still tested.
+func Run(files []string, opts Options) (report Report) {
+    start := time.Now()
+    var sources []source
+    for _, name := range files {
+        data, err := os.ReadFile(name)
+        if err == nil {
+            src := source{name: name, text: string(data)}
+            if _, err = load(append(sources, src), 0); err == nil {
+                sources = append(sources, src)
+                continue
+            }
+        }
+        res := Result{Name: name, Loc: lexer.Location{Source: name, Line: 1, Column: 1}}
+        res.Failure = &Failure{Loc: res.Loc, Message: err.Error()}
+        var lerr *loadError
+        if errors.As(err, &lerr) {
+            res.Failure = &Failure{Loc: lerr.Loc, Message: lerr.Msg}
+        }
+        report.Failed += 1
+        report.Results = append(report.Results, res)
+    }
+    all, _ := load(sources, 0)
+
+    for i, test := range all.Tests {
+        if opts.Run != nil && !opts.Run.MatchString(test.Name) { continue }
+        res := runOne(sources, i + 1, &test, opts)
+        if res.Passed {
+            report.Passed += 1
+        } else {
+            report.Failed += 1
+        }
+        report.Results = append(report.Results, res)
+    }
+    report.Duration = time.Since(start)
+    report.DurationMs = float64(report.Duration.Microseconds()) / 1000
+    return report
+}
+
+// parsing sources again gives test fresh functions and bindings
+func runOne(sources []source, n int, test *parser.Test, opts Options) (res Result) {
+    res.Name, res.Loc = test.Name, test.Loc
+    gs, err := load(sources, n)
+    if err == nil && len(gs.Tests) < n { err = fmt.Errorf("test is not defined") }
+    if err != nil {
+        res.Failure = &Failure{Loc: test.Loc, Message: err.Error()}
+        return
+    }
+    test = &gs.Tests[n-1]
+
+    ctx, cancel := context.Background(), context.CancelFunc(func() {})
+    if opts.Timeout > 0 {
+        ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+    }
+    defer cancel()
+    gs.Ctx = ctx
+
+    start := time.Now()
+    err = gs.RunTest(test)
+    res.Duration = time.Since(start)
+    res.DurationMs = float64(res.Duration.Microseconds()) / 1000
+
+    var aerr *parser.AssertionError
+    var derr *parser.DepthError
+    switch {
+    case err == nil:
+        res.Passed = true
+    case errors.As(err, &aerr):
+        res.Failure = &Failure{Loc: aerr.Loc, Message: aerr.Error()}
+    case errors.As(err, &derr):
+        res.Failure = &Failure{Loc: derr.Loc, Message: derr.Error()}
+    case errors.Is(err, context.DeadlineExceeded):
+        res.Failure = &Failure{Loc: test.Loc, Message: fmt.Sprintf("timed out after %s", opts.Timeout)}
+    default:
+        res.Failure = &Failure{Loc: test.Loc, Message: err.Error()}
+    }
+    return
+}
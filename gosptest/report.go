@@ -0,0 +1,119 @@
+package gosptest
+
+import (
+    "encoding/json"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "time"
+)
+
+// go test like output
+func (r *Report) WriteText(w io.Writer, verbose bool) {
+    for _, res := range r.Results {
+        if res.Passed {
+            if verbose { fmt.Fprintf(w, "--- PASS: %s (%s)\n", res.Name, seconds(res.Duration)) }
+            continue
+        }
+        fmt.Fprintf(w, "--- FAIL: %s (%s)\n", res.Name, seconds(res.Duration))
+        fmt.Fprintf(w, "    %s: %s\n", res.Failure.Loc.Loc(), res.Failure.Message)
+    }
+    total := r.Passed + r.Failed
+    if r.Failed > 0 {
+        fmt.Fprintf(w, "FAIL: %d of %d tests failed (%s)\n", r.Failed, total, seconds(r.Duration))
+    } else {
+        fmt.Fprintf(w, "ok: %d tests passed (%s)\n", total, seconds(r.Duration))
+    }
+}
+
+func seconds(d time.Duration) string {
+    return fmt.Sprintf("%.3fs", d.Seconds())
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    return enc.Encode(r)
+}
+
+type junitFailure struct {
+    Message string `xml:"message,attr"`
+    Type    string `xml:"type,attr"`
+    Text    string `xml:",chardata"`
+}
+
+type junitCase struct {
+    Name      string        `xml:"name,attr"`
+    Classname string        `xml:"classname,attr"`
+    File      string        `xml:"file,attr"`
+    Line      int           `xml:"line,attr"`
+    Time      string        `xml:"time,attr"`
+    Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitSuite struct {
+    Name     string      `xml:"name,attr"`
+    Tests    int         `xml:"tests,attr"`
+    Failures int         `xml:"failures,attr"`
+    Time     string      `xml:"time,attr"`
+    Cases    []junitCase `xml:"testcase"`
+}
+
+type junitSuites struct {
+    XMLName  xml.Name     `xml:"testsuites"`
+    Tests    int          `xml:"tests,attr"`
+    Failures int          `xml:"failures,attr"`
+    Time     string       `xml:"time,attr"`
+    Suites   []junitSuite `xml:"testsuite"`
+}
+
+// JUnit XML with one testsuite per source file
+func (r *Report) WriteJUnit(w io.Writer) error {
+    out := junitSuites{
+        Tests:    r.Passed + r.Failed,
+        Failures: r.Failed,
+        Time:     fmt.Sprintf("%.3f", r.Duration.Seconds()),
+    }
+    index := make(map[string]int)
+    for _, res := range r.Results {
+        file := res.Loc.Source
+        i, ok := index[file]
+        if !ok {
+            i = len(out.Suites)
+            index[file] = i
+            out.Suites = append(out.Suites, junitSuite{Name: file})
+        }
+        suite := &out.Suites[i]
+        tc := junitCase{
+            Name:      res.Name,
+            Classname: file,
+            File:      file,
+            Line:      res.Loc.Line,
+            Time:      fmt.Sprintf("%.3f", res.Duration.Seconds()),
+        }
+        if res.Failure != nil {
+            tc.Failure = &junitFailure{
+                Message: res.Failure.Message,
+                Type:    "failure",
+                Text:    res.Failure.Loc.Loc() + ": " + res.Failure.Message,
+            }
+            suite.Failures += 1
+        }
+        suite.Tests += 1
+        suite.Cases = append(suite.Cases, tc)
+    }
+    for i := range out.Suites {
+        var d time.Duration
+        for _, res := range r.Results {
+            if res.Loc.Source == out.Suites[i].Name { d += res.Duration }
+        }
+        out.Suites[i].Time = fmt.Sprintf("%.3f", d.Seconds())
+    }
+
+    if _, err := io.WriteString(w, xml.Header); err != nil { return err }
+    enc := xml.NewEncoder(w)
+    enc.Indent("", "  ")
+    if err := enc.Encode(out); err != nil { return err }
+    _, err := io.WriteString(w, "\n")
+    return err
+}
@@ -0,0 +1,62 @@
+package lexer
+
+import (
+    "testing"
+)
+
+var fuzzSeeds = []string{
+    "",
+    "(+ 1.0 2.0)",
+    "(- 10.0 -2.5) (+ -.5 .5) 1. -7 - -- -.",
+    "\"quote \\\" and backslash \\\\\" \"line\\nbreak\" \"bad \\q\" \"unclosed",
+    "(defun sq (x double) \"Squares x\" (* x x)) ; comment\n(sq 3.0)",
+    "[1.0 \"b\"] [[1.0] [2.0]] {} , true false",
+    "#@\x00\xff 12abc 1.2.3 -x",
+    "; only comment",
+}
+
+// line and column of raw offset, as tracked by SkipChar
+func lineColumn(chars []rune, raw int) (line, column int) {
+    line, column = 1, 1
+    for i := 0; i < raw; i++ {
+        column += 1
+        if chars[i] == '\n' { line, column = line + 1, 1 }
+    }
+    return
+}
+
+// Lexes whole input, every token must make progress and start where
+// its location says, tokens come in order of their locations
+func FuzzParseToken(f *testing.F) {
+    for _, seed := range fuzzSeeds {
+        f.Add(seed, false)
+    }
+    f.Fuzz(func(t *testing.T, src string, keepComments bool) {
+        l := LexerInit()
+        l.KeepComments = keepComments
+        l.AddSourceNamed("fuzz", src)
+        chars := l.Sources[0].Chars
+
+        prev := l.Cursor
+        for i := 0; ; i++ {
+            if i > len(chars) { t.Fatalf("more tokens than characters") }
+            if !l.ParseToken() { break }
+            if l.Cursor.Raw <= l.TokenLoc.Raw {
+                t.Fatalf("token at %s made no progress", l.TokenLoc.Loc())
+            }
+            if l.TokenLoc.Raw < prev.Raw {
+                t.Fatalf("token at %s starts before end of previous one at %s", l.TokenLoc.Loc(), prev.Loc())
+            }
+            line, column := lineColumn(chars, l.TokenLoc.Raw)
+            if l.TokenLoc.Line != line || l.TokenLoc.Column != column {
+                t.Fatalf("token at raw %d has location %s, expected %d:%d",
+                    l.TokenLoc.Raw, l.TokenLoc.Loc(), line, column)
+            }
+            if l.Err != nil {
+                if l.ErrLoc != l.TokenLoc { t.Fatalf("error at %s, token at %s", l.ErrLoc.Loc(), l.TokenLoc.Loc()) }
+                break
+            }
+            prev = l.Cursor
+        }
+    })
+}
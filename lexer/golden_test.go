@@ -0,0 +1,70 @@
+package lexer
+
+import (
+    "flag"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+var update = flag.Bool("update", false, "rewrite .golden files with current output")
+
+// Each testdata/name.gosp is lexed with ParseToken, kinds, locations
+// and values of tokens are compared with name.golden
+func TestTokensGolden(t *testing.T) {
+    inputs, err := filepath.Glob(filepath.Join("testdata", "*.gosp"))
+    if err != nil { t.Fatal(err) }
+    if len(inputs) == 0 { t.Fatal("no inputs in testdata") }
+
+    for _, input := range inputs {
+        name := strings.TrimSuffix(filepath.Base(input), ".gosp")
+        t.Run(name, func(t *testing.T) {
+            src, err := os.ReadFile(input)
+            if err != nil { t.Fatal(err) }
+            got := dumpTokens(name + ".gosp", string(src))
+
+            golden := strings.TrimSuffix(input, ".gosp") + ".golden"
+            if *update {
+                if err := os.WriteFile(golden, []byte(got), 0644); err != nil { t.Fatal(err) }
+                return
+            }
+            want, err := os.ReadFile(golden)
+            if err != nil { t.Fatalf("%s (run `go test ./lexer -run TestTokensGolden -update`)", err) }
+            if got != string(want) {
+                t.Errorf("tokens differ from %s\n--- got:\n%s\n--- want:\n%s", golden, got, want)
+            }
+        })
+    }
+}
+
+// one line per token, lexing goes on after errors while it makes progress
+func dumpTokens(source, text string) string {
+    l := LexerInit()
+    l.KeepComments = true
+    l.AddSourceNamed(source, text)
+
+    var b strings.Builder
+    for l.ParseToken() {
+        fmt.Fprintf(&b, "%d:%d %s", l.TokenLoc.Line, l.TokenLoc.Column, l.Type.Str())
+        switch l.Type {
+        case TokenId, TokenStr, TokenComment:
+            fmt.Fprintf(&b, " %q", l.Str)
+        case TokenInt:
+            fmt.Fprintf(&b, " %d", l.Int)
+        case TokenDouble:
+            fmt.Fprintf(&b, " %s", strconv.FormatFloat(l.Double, 'g', -1, 64))
+        case TokenBool:
+            fmt.Fprintf(&b, " %t", l.Bool)
+        }
+        if l.Err != nil {
+            fmt.Fprintf(&b, " at %d:%d: %s", l.ErrLoc.Line, l.ErrLoc.Column, l.Err.Error())
+            l.Err = nil
+        }
+        b.WriteString("\n")
+        if l.Cursor.Raw <= l.TokenLoc.Raw { break }
+    }
+    return b.String()
+}
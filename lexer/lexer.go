@@ -55,6 +55,7 @@ const (
     TokenInt
     TokenDouble
     TokenBool
+    TokenComment
     TokenError
 )
 func (t TokenType) OToC() TokenType {
@@ -99,6 +100,7 @@ func (t TokenType) Str() string {
     case TokenInt:      return "int"
     case TokenDouble:   return "double"
     case TokenBool:     return "bool"
+    case TokenComment:  return "comment"
     case TokenError:    return "error"
     }
     return "unknown"
@@ -125,6 +127,9 @@ type Lexer struct {
     ErrLoc   Location
     
     NextFile bool
+    
+    // `;` comments are returned as TokenComment instead of being skipped
+    KeepComments bool
 }
 func LexerInit() (l Lexer) {
     l.Cursor.SourceIndex   = -1
@@ -204,16 +209,24 @@ func (loc *Location) GetChar(l *Lexer) (ch rune, state ReadState) {
     state = loc.SkipChar(l, ch)
     return
 }
+// skips whitespace and, unless KeepComments is set, comments up to end of line
 func (l *Lexer) SkipSpaces(skipSources bool) (state ReadState) {
     var ch rune
+    comment := false
     for {
         ch, state = l.Cursor.PeekChar(l)
         switch state {
         case ReadNone: return
-        case ReadOk:   if !unicode.IsSpace(ch) { return ReadOk }
+        case ReadOk:
+            if ch == ';' && !l.KeepComments { comment = true }
+            if ch == '\n' { comment = false }
+            if !comment && !unicode.IsSpace(ch) { return ReadOk }
         }
         state = l.Cursor.SkipChar(l, ch)
-        if state == ReadEOF && !skipSources { return }
+        if state == ReadEOF {
+            comment = false
+            if !skipSources { return }
+        }
     }
 }
 func (l *Lexer) SetChToken(ch rune, kind TokenType) {
@@ -238,11 +251,13 @@ func (l *Lexer) ParseNumber() bool {
     var err error
     numStr := ""
     
-    ch, state := l.Cursor.GetChar(l)
+    // GetChar reports ReadNone after the last char of input, so peek first
+    ch, state := l.Cursor.PeekChar(l)
     isNegative := ch == '-'
     isFloating := ch == '.'
     
-    if state == ReadNone { goto restore }
+    if state != ReadOk { goto restore }
+    l.Cursor.SkipChar(l, ch)
     if unicode.IsDigit(ch) {
         beforeFloat = append(beforeFloat, ch)
     } else if !isNegative && !isFloating { goto restore }
@@ -265,6 +280,10 @@ func (l *Lexer) ParseNumber() bool {
     if isFloating && len(afterFloat) == 0 && len(beforeFloat) == 0 {
         goto restore
     }
+    // lone `-` is id, e.g. function name
+    if isNegative && !isFloating && len(beforeFloat) == 0 {
+        goto restore
+    }
     if isNegative {
         numStr += "-"
     }
@@ -357,6 +376,18 @@ func (l *Lexer) ParseToken() bool {
     case ',':
         l.SetChToken(ch, TokenComma)
         return true
+    case ';':
+        // only reached with KeepComments, Str is text without newline
+        var chars []rune
+        for {
+            ch, state = l.Cursor.PeekChar(l)
+            if state != ReadOk || ch == '\n' { break }
+            chars = append(chars, ch)
+            if l.Cursor.SkipChar(l, ch) == ReadEOF { break }
+        }
+        l.Type = TokenComment
+        l.Str  = string(chars)
+        return true
     case '"':
         if l.Cursor.SkipChar(l, ch) == ReadEOF {
             l.SetErr(fmt.Errorf("unclosed string literal"))
@@ -405,5 +436,4 @@ func (l *Lexer) ParseToken() bool {
         l.UnknownToken(ch)
         return true
     }
-    return false
 }
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 	"io"
@@ -9,8 +10,6 @@ import (
 	"strconv"
 	"path/filepath"
 )
-const DEBUG = true
-const COLORED = true
 const PRINT_CHAR_BASE = 10
 
 type ControlKey uint16
@@ -49,7 +48,7 @@ const (
 	US  = 31
 	DEL = 127
 )
-const ESC_STR = string(ESC)
+const ESC_STR = string(rune(ESC))
 
 type Color uint16
 const (
@@ -90,15 +89,15 @@ func (c Color) foreCode() string {
 	case BrightMagenta: return "95"
 	case BrightCyan:    return "96"
 	case BrightWhite:   return "97"
-	default: Unreachable("Unknown color: %d", uint16(c))
 	}
-	return ""
+	// unknown color is printed as default one
+	return "39"
 }
 func (c Color) foreEscaped() string {
 	return ESC_STR + "[" + c.foreCode() + "m"
 }
 func (c Color) Colorf(format string, args ...any) string {
-	if COLORED {
+	if Colored() {
 		return fmt.Sprintf(c.foreEscaped() + format + ColorDefault.foreEscaped(), args...)
 	}
 	return fmt.Sprintf(format, args...)
@@ -160,32 +159,48 @@ func Eprintf(format string, args ...any) {
 	Fprintf(os.Stderr, -1, format, args...)
 }
 func Errorf(format string, args ...any) {
-	Fprintf(os.Stderr, -1, "ERROR: " + format + "\n", args...)
+	logger.Error(fmt.Sprintf(format, args...))
 }
 func Infof(format string, args ...any) {
-	Fprintf(os.Stdout, -1, "INFO: " + format + "\n", args...)
+	logger.Info(fmt.Sprintf(format, args...))
 }
 func Debugf(format string, args ...any) {
-	if DEBUG {
-		Fprintf(os.Stdout, -1, "DEBUG: " + format + "\n", args...)
+	if logger.Enabled(context.Background(), LevelDebug) {
+		logger.Debug(fmt.Sprintf(format, args...))
 	}
 }
-func Abortf(format string, args ...any) {
-	abortf(1, format, args...)
+type Format uint8
+const (
+	FormatText Format = iota
+	FormatJSON
+)
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "text": return FormatText, nil
+	case "json": return FormatJSON, nil
+	}
+	return FormatText, fmt.Errorf("unknown log format: %s", name)
 }
-func Todof(format string, args ...any) {
-	Fprintf(os.Stderr, 1, "TODO: " + format + "\n", args...)
-	os.Exit(1)
+
+// Records with key/value pairs: `INFO: msg key=value ...` or JSON object,
+// see Configure
+func Debug(msg string, kv ...any) {
+	logger.Debug(msg, kv...)
 }
-func Unreachable(format string, args ...any) {
-	abortf(1, "unreachable: " + format, args...)
+func Info(msg string, kv ...any) {
+	logger.Info(msg, kv...)
 }
-func Assert(cond bool, msg string) {
-	if !cond { abortf(1, "assertion failed: %s", msg) }
+func Warn(msg string, kv ...any) {
+	logger.Warn(msg, kv...)
+}
+func Error(msg string, kv ...any) {
+	logger.Error(msg, kv...)
 }
 
-func abortf(skip int, format string, args ...any) {
-	Fprintf(os.Stderr, skip + 1, "ABORT: " + format + "\n", args...)
+// Prints message and exits the process, only for package main.
+// Library code returns errors instead, see parser.InternalError.
+func Abortf(format string, args ...any) {
+	Fprintf(os.Stderr, 1, "ABORT: " + format + "\n", args...)
 	os.Exit(1)
 }
 
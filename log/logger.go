@@ -0,0 +1,247 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level = slog.Level
+const (
+	LevelDebug = slog.LevelDebug
+	LevelInfo  = slog.LevelInfo
+	LevelWarn  = slog.LevelWarn
+	LevelError = slog.LevelError
+)
+
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":           return LevelDebug, nil
+	case "info":            return LevelInfo, nil
+	case "warn", "warning": return LevelWarn, nil
+	case "error":           return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level: %s", name)
+}
+
+// destination of records, shared by all loggers, so that component
+// loggers created before Configure follow it
+type sink struct {
+	mu     sync.Mutex
+	level  slog.LevelVar
+	format Format
+	color  bool
+	times  bool      // text records start with time
+	out    io.Writer // records below error level
+	errOut io.Writer
+	closer io.Closer
+}
+
+var std = &sink{out: os.Stdout, errOut: os.Stderr, color: colorTerminal(os.Stdout)}
+
+// color is used by terminals only, NO_COLOR disables it (https://no-color.org)
+func colorTerminal(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" { return false }
+	st, err := f.Stat()
+	return err == nil && st.Mode() & os.ModeCharDevice != 0
+}
+
+// Whether standard output is colored, see Colorf
+func Colored() bool {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	return std.color
+}
+
+type Options struct {
+	Level      Level
+	Format     Format
+	File       string // records go to stdout and stderr when empty
+	MaxSize    int64  // size of File in bytes before rotation, no rotation when <= 0
+	MaxBackups int    // rotated files kept
+}
+
+// Applies options to all loggers, including ones of log/slog.
+// Previously opened file is closed.
+func Configure(opts Options) error {
+	var file *RotatingFile
+	if opts.File != "" {
+		var err error
+		file, err = OpenRotating(opts.File, opts.MaxSize, opts.MaxBackups)
+		if err != nil { return err }
+	}
+
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	if std.closer != nil {
+		std.closer.Close()
+		std.closer = nil
+	}
+	std.level.Set(opts.Level)
+	std.format = opts.Format
+	if file != nil {
+		std.out, std.errOut, std.closer = file, file, file
+		std.color, std.times = false, true
+	} else {
+		std.out, std.errOut = os.Stdout, os.Stderr
+		std.color, std.times = colorTerminal(os.Stdout), false
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+func SetLevel(level Level) {
+	std.level.Set(level)
+}
+
+// slog.Handler writing `LEVEL: msg key=value ...` lines or JSON objects
+type Handler struct {
+	sink   *sink
+	attrs  []slog.Attr // keys already have group prefix
+	prefix string      // group prefix of following attrs
+}
+
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.sink.level.Level()
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = appendAttrs(h.attrs[:len(h.attrs):len(h.attrs)], h.prefix, attrs...)
+	return &h2
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" { return h }
+	h2 := *h
+	h2.prefix += name + "."
+	return &h2
+}
+
+// groups are flattened into `group.key`
+func appendAttrs(dst []slog.Attr, prefix string, attrs ...slog.Attr) []slog.Attr {
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+		if a.Equal(slog.Attr{}) { continue }
+		if a.Value.Kind() == slog.KindGroup {
+			sub := prefix
+			if a.Key != "" { sub += a.Key + "." }
+			dst = appendAttrs(dst, sub, a.Value.Group()...)
+			continue
+		}
+		a.Key = prefix + a.Key
+		dst = append(dst, a)
+	}
+	return dst
+}
+
+var levelColors = map[slog.Level]Color{
+	LevelDebug: BrightBlack,
+	LevelInfo:  Green,
+	LevelWarn:  Yellow,
+	LevelError: Red,
+}
+
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	attrs := h.attrs[:len(h.attrs):len(h.attrs)]
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = appendAttrs(attrs, h.prefix, a)
+		return true
+	})
+
+	s := h.sink
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b bytes.Buffer
+	if s.format == FormatJSON {
+		writeJSON(&b, r, attrs)
+	} else {
+		writeText(&b, r, attrs, s.times, s.color)
+	}
+	w := s.out
+	if r.Level >= LevelError { w = s.errOut }
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func writeText(b *bytes.Buffer, r slog.Record, attrs []slog.Attr, times, color bool) {
+	if times && !r.Time.IsZero() {
+		b.WriteString(r.Time.Format("2006-01-02T15:04:05.000Z07:00"))
+		b.WriteString(" ")
+	}
+	level := r.Level.String()
+	if c, ok := levelColors[r.Level]; ok && color {
+		level = c.foreEscaped() + level + ColorDefault.foreEscaped()
+	}
+	b.WriteString(level)
+	b.WriteString(": ")
+	b.WriteString(r.Message)
+	for _, a := range attrs {
+		val := textValue(a.Value)
+		if val == "" || strings.ContainsAny(val, " \t\n\"=") {
+			val = strconv.Quote(val)
+		}
+		fmt.Fprintf(b, " %s=%s", a.Key, val)
+	}
+	b.WriteString("\n")
+}
+
+func textValue(v slog.Value) string {
+	switch v.Kind() {
+	case slog.KindTime: return v.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok { return err.Error() }
+	}
+	return v.String()
+}
+
+func jsonValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindDuration: return v.Duration().String()
+	case slog.KindTime:     return v.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok { return err.Error() }
+	}
+	return v.Any()
+}
+
+// keys are in order of attributes, after time, level and msg
+func writeJSON(b *bytes.Buffer, r slog.Record, attrs []slog.Attr) {
+	field := func(key string, val any) {
+		if b.Len() > 1 { b.WriteString(",") }
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(val)
+		if err != nil { v, _ = json.Marshal(fmt.Sprint(val)) }
+		b.Write(k)
+		b.WriteString(":")
+		b.Write(v)
+	}
+	b.WriteString("{")
+	field("time",  r.Time.Format(time.RFC3339Nano))
+	field("level", r.Level.String())
+	field("msg",   r.Message)
+	for _, a := range attrs {
+		field(a.Key, jsonValue(a.Value))
+	}
+	b.WriteString("}\n")
+}
+
+var logger = slog.New(&Handler{sink: std})
+
+// Logger of the whole program, the same as slog.Default after Configure
+func Default() *slog.Logger {
+	return logger
+}
+
+// Logger whose records have `component` attribute, e.g. server, storage or eval
+func Component(name string) *slog.Logger {
+	return logger.With("component", name)
+}
@@ -0,0 +1,77 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func testHandler(format Format) (h *Handler, out, errOut *bytes.Buffer) {
+	out, errOut = &bytes.Buffer{}, &bytes.Buffer{}
+	s := &sink{format: format, out: out, errOut: errOut}
+	s.level.Set(LevelInfo)
+	return &Handler{sink: s}, out, errOut
+}
+
+var testTime = time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+func testRecord(level Level, msg string, args ...any) slog.Record {
+	r := slog.NewRecord(testTime, level, msg, 0)
+	r.Add(args...)
+	return r
+}
+
+func TestHandlerText(t *testing.T) {
+	h, out, errOut := testHandler(FormatText)
+	hh := h.WithAttrs([]slog.Attr{slog.String("component", "server")}).WithGroup("req")
+
+	err := hh.Handle(context.Background(), testRecord(LevelInfo, "request",
+		"path", "/api/expr", "status", 200, "user", "", "note", `say "hi"`,
+		slog.Group("db", "ms", 1.5)))
+	if err != nil { t.Fatal(err) }
+	want := `INFO: request component=server req.path=/api/expr req.status=200 req.user="" req.note="say \"hi\"" req.db.ms=1.5` + "\n"
+	if out.String() != want {
+		t.Errorf("got  %q\nwant %q", out.String(), want)
+	}
+
+	err = h.Handle(context.Background(), testRecord(LevelError, "failed", "error", errors.New("no route")))
+	if err != nil { t.Fatal(err) }
+	if want := "ERROR: failed error=\"no route\"\n"; errOut.String() != want {
+		t.Errorf("error records go to errOut: got %q, want %q", errOut.String(), want)
+	}
+
+	h.sink.times = true
+	out.Reset()
+	if err := h.Handle(context.Background(), testRecord(LevelWarn, "slow")); err != nil { t.Fatal(err) }
+	if want := "2024-05-01T12:30:00.000Z WARN: slow\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestHandlerJSON(t *testing.T) {
+	h, out, _ := testHandler(FormatJSON)
+	hh := h.WithAttrs([]slog.Attr{slog.String("component", "eval")})
+
+	err := hh.Handle(context.Background(), testRecord(LevelInfo, "done",
+		"took", 1500 * time.Millisecond, "error", errors.New("boom"), "n", 3))
+	if err != nil { t.Fatal(err) }
+	want := `{"time":"2024-05-01T12:30:00Z","level":"INFO","msg":"done","component":"eval","took":"1.5s","error":"boom","n":3}` + "\n"
+	if out.String() != want {
+		t.Errorf("got  %s\nwant %s", out.String(), want)
+	}
+}
+
+func TestHandlerLevel(t *testing.T) {
+	h, out, _ := testHandler(FormatText)
+	l := slog.New(h)
+	l.Debug("hidden")
+	if out.Len() != 0 { t.Errorf("debug record written at info level: %q", out.String()) }
+	h.sink.level.Set(LevelDebug)
+	l.Debug("shown")
+	if want := "DEBUG: shown\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
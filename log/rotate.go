@@ -0,0 +1,83 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Log file which is rotated once it grows over MaxSize:
+// name is renamed to name.1, name.1 to name.2 and so on up to MaxBackups
+type RotatingFile struct {
+	Name       string
+	MaxSize    int64 // bytes, no rotation when <= 0
+	MaxBackups int   // rotated files kept, older ones are removed
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Opens file for appending, records are added to existing content
+func OpenRotating(name string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	rf := &RotatingFile{Name: name, MaxSize: maxSize, MaxBackups: maxBackups}
+	if err := rf.open(); err != nil { return nil, err }
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.Name, os.O_CREATE | os.O_WRONLY | os.O_APPEND, 0644)
+	if err != nil { return err }
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file, rf.size = f, st.Size()
+	return nil
+}
+
+func (rf *RotatingFile) backup(n int) string {
+	return fmt.Sprintf("%s.%d", rf.Name, n)
+}
+
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil { return err }
+	rf.file = nil
+	if rf.MaxBackups <= 0 {
+		if err := os.Remove(rf.Name); err != nil && !os.IsNotExist(err) { return err }
+		return rf.open()
+	}
+	os.Remove(rf.backup(rf.MaxBackups))
+	for n := rf.MaxBackups - 1; n >= 1; n-- {
+		err := os.Rename(rf.backup(n), rf.backup(n + 1))
+		if err != nil && !os.IsNotExist(err) { return err }
+	}
+	if err := os.Rename(rf.Name, rf.backup(1)); err != nil && !os.IsNotExist(err) { return err }
+	return rf.open()
+}
+
+// Record is never split between files, file is rotated before it
+// when record doesn't fit
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		if err := rf.open(); err != nil { return 0, err }
+	}
+	if rf.MaxSize > 0 && rf.size > 0 && rf.size + int64(len(p)) > rf.MaxSize {
+		if err := rf.rotate(); err != nil { return 0, err }
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil { return nil }
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
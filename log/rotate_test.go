@@ -0,0 +1,57 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil { t.Fatal(err) }
+	return string(data)
+}
+
+func TestRotatingFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "gosp.log")
+	if err := os.WriteFile(name, []byte("old\n"), 0644); err != nil { t.Fatal(err) }
+
+	rf, err := OpenRotating(name, 10, 2)
+	if err != nil { t.Fatal(err) }
+	defer rf.Close()
+
+	// existing content is kept, records are not split between files
+	for _, rec := range []string{"aaaa\n", "bbbbb\n", "cc\n", "dddddddddddd\n", "e\n"} {
+		if _, err := rf.Write([]byte(rec)); err != nil { t.Fatal(err) }
+	}
+	if got := readFile(t, name); got != "e\n" {
+		t.Errorf("%s: got %q", name, got)
+	}
+	if got := readFile(t, name + ".1"); got != "dddddddddddd\n" {
+		t.Errorf("%s.1: got %q", name, got)
+	}
+	if got := readFile(t, name + ".2"); got != "bbbbb\ncc\n" {
+		t.Errorf("%s.2: got %q", name, got)
+	}
+	if _, err := os.Stat(name + ".3"); !os.IsNotExist(err) {
+		t.Errorf("only 2 backups are kept, %s.3: %v", name, err)
+	}
+}
+
+func TestRotatingFileNoBackups(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "gosp.log")
+	rf, err := OpenRotating(name, 4, 0)
+	if err != nil { t.Fatal(err) }
+	defer rf.Close()
+
+	for _, rec := range []string{"ab\n", "cd\n"} {
+		if _, err := rf.Write([]byte(rec)); err != nil { t.Fatal(err) }
+	}
+	if got := readFile(t, name); got != "cd\n" {
+		t.Errorf("got %q", got)
+	}
+	if _, err := os.Stat(name + ".1"); !os.IsNotExist(err) {
+		t.Errorf("no backups are kept, %s.1: %v", name, err)
+	}
+}
@@ -0,0 +1,338 @@
+package lsp
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/Fipaan/gosp/lexer"
+	"github.com/Fipaan/gosp/parser"
+)
+
+type token struct {
+    Type  lexer.TokenType
+    Str   string
+    Start int // rune offsets in document
+    End   int
+    Close int // index of matching close token for ( and [, -1 otherwise
+}
+
+const (
+    symbolFunc = iota
+    symbolArg
+    symbolLet
+)
+
+// name introduced by defun, its arguments or let
+type symbol struct {
+    Name    string
+    Kind    int
+    Detail  string
+    NameTok int // index of name token
+    Form    int // index of ( token of defun or let
+    // tokens [ScopeStart, ScopeEnd) can refer to the name
+    ScopeStart int
+    ScopeEnd   int
+    Args       []*symbol // of defun
+}
+
+// Parsed document. Nothing is evaluated, defuns are registered by parsing.
+type Document struct {
+    URI     string
+    Version int
+    Text    string
+
+    runes      []rune
+    lineStarts []int // rune offsets
+    tokens     []token
+    symbols    []*symbol // in order of appearance
+    gs         parser.GospState
+
+    Diagnostics []Diagnostic
+}
+
+func NewDocument(uri string, version int, text string) *Document {
+    d := &Document{URI: uri, Version: version, Text: text, runes: []rune(text)}
+    d.lineStarts = []int{0}
+    for i, ch := range d.runes {
+        if ch == '\n' { d.lineStarts = append(d.lineStarts, i + 1) }
+    }
+    d.scan()
+    d.findSymbols()
+    d.parse()
+    return d
+}
+
+// offset in runes to LSP position
+func (d *Document) position(offset int) Position {
+    offset = min(max(offset, 0), len(d.runes))
+    line := sort.Search(len(d.lineStarts), func(i int) bool { return d.lineStarts[i] > offset }) - 1
+    start := d.lineStarts[line]
+    return Position{Line: line, Character: len(utf16.Encode(d.runes[start:offset]))}
+}
+
+func (d *Document) offset(pos Position) int {
+    if pos.Line < 0 { return 0 }
+    if pos.Line >= len(d.lineStarts) { return len(d.runes) }
+    offset := d.lineStarts[pos.Line]
+    for units := 0; offset < len(d.runes) && d.runes[offset] != '\n'; offset++ {
+        units += len(utf16.Encode([]rune{d.runes[offset]}))
+        if units > pos.Character { break }
+    }
+    return offset
+}
+
+func (d *Document) rangeOf(start, end int) Range {
+    return Range{Start: d.position(start), End: d.position(end)}
+}
+
+func (d *Document) tokenRange(i int) Range {
+    return d.rangeOf(d.tokens[i].Start, d.tokens[i].End)
+}
+
+// range of ( ... ) form starting at token i
+func (d *Document) formRange(i int) Range {
+    end := d.tokens[len(d.tokens)-1].End
+    if close := d.tokens[i].Close; close >= 0 { end = d.tokens[close].End }
+    return d.rangeOf(d.tokens[i].Start, end)
+}
+
+func (d *Document) scan() {
+    l := lexer.LexerInit()
+    l.AddSourceNamed(d.URI, d.Text)
+    var opens []int
+    for {
+        if l.SkipSpaces(true) != lexer.ReadOk { break }
+        start := l.Cursor.Raw
+        if !l.ParseToken() || l.Cursor.Raw <= start { break }
+        tok := token{Type: l.Type, Str: l.Str, Start: start, End: l.Cursor.Raw, Close: -1}
+        if tok.Type == lexer.TokenInt || tok.Type == lexer.TokenDouble || tok.Type == lexer.TokenBool {
+            tok.Str = string(d.runes[tok.Start:tok.End])
+        }
+        d.tokens = append(d.tokens, tok)
+
+        i := len(d.tokens) - 1
+        switch tok.Type {
+        case lexer.TokenOParen, lexer.TokenOBracket:
+            opens = append(opens, i)
+        case lexer.TokenCParen, lexer.TokenCBracket:
+            if len(opens) > 0 && d.tokens[opens[len(opens)-1]].Type.OToC() == tok.Type {
+                d.tokens[opens[len(opens)-1]].Close = i
+                opens = opens[:len(opens)-1]
+            }
+        }
+    }
+}
+
+// index after expression starting at token i
+func (d *Document) skipExpr(i int) int {
+    if i >= len(d.tokens) { return i }
+    if d.tokens[i].Close >= 0 { return d.tokens[i].Close + 1 }
+    if t := d.tokens[i].Type; t == lexer.TokenOParen || t == lexer.TokenOBracket {
+        return len(d.tokens) // unclosed
+    }
+    return i + 1
+}
+
+func (d *Document) isId(i int, name string) bool {
+    return i < len(d.tokens) && d.tokens[i].Type == lexer.TokenId &&
+           (name == "" || d.tokens[i].Str == name)
+}
+
+func (d *Document) text(start, end int) string {
+    if start >= end || start >= len(d.tokens) { return "" }
+    end = min(end, len(d.tokens))
+    return string(d.runes[d.tokens[start].Start:d.tokens[end-1].End])
+}
+
+func (d *Document) findSymbols() {
+    for i := 0; i < len(d.tokens); i++ {
+        if d.tokens[i].Type != lexer.TokenOParen { continue }
+        end := d.skipExpr(i)
+        switch {
+        case d.isId(i+1, "defun") && d.isId(i+2, ""):
+            fn := &symbol{Name: d.tokens[i+2].Str, Kind: symbolFunc, NameTok: i + 2, Form: i,
+                          ScopeStart: end, ScopeEnd: len(d.tokens)}
+            sig := []string{fn.Name}
+            if j := i + 3; j < len(d.tokens) && d.tokens[j].Type == lexer.TokenOParen {
+                for k := j + 1; k + 1 < d.skipExpr(j) - 1; k += 2 {
+                    if !d.isId(k, "") { break }
+                    sig = append(sig, d.tokens[k].Str + " " + d.tokens[k+1].Str)
+                    fn.Args = append(fn.Args, &symbol{
+                        Name: d.tokens[k].Str, Kind: symbolArg, NameTok: k, Form: i,
+                        Detail:     d.tokens[k+1].Str + ", argument of " + fn.Name,
+                        ScopeStart: d.skipExpr(j), ScopeEnd: end,
+                    })
+                }
+            }
+            fn.Detail = "(" + strings.Join(sig, " ") + ")"
+            d.symbols = append(d.symbols, fn)
+            d.symbols = append(d.symbols, fn.Args...)
+        case d.isId(i+1, "let") && d.isId(i+2, ""):
+            valEnd := d.skipExpr(i + 3)
+            d.symbols = append(d.symbols, &symbol{
+                Name: d.tokens[i+2].Str, Kind: symbolLet, NameTok: i + 2, Form: i,
+                Detail:     "(let " + d.tokens[i+2].Str + " " + d.text(i+3, valEnd) + ")",
+                ScopeStart: valEnd, ScopeEnd: end,
+            })
+        }
+    }
+}
+
+func (d *Document) parse() {
+    d.gs = parser.GospInit()
+    p := parser.ParserInit()
+    p.AddSourceNamed(d.URI, d.Text)
+    next := 0 // token of next top-level expression
+    for {
+        if p.SkipSpaces(true) != lexer.ReadOk { break }
+        start := p.Cursor
+        for next < len(d.tokens) && d.tokens[next].Start < start.Raw { next++ }
+        if next >= len(d.tokens) { break }
+
+        _, ok := p.ParseExpr(&d.gs)
+        if ok && p.Cursor.Raw > start.Raw { continue }
+
+        msg := "syntax error"
+        if p.Err != nil { msg = p.Err.Error() }
+        errTok := next
+        for errTok + 1 < len(d.tokens) && d.tokens[errTok+1].Start <= p.ErrLoc.Raw { errTok++ }
+        if ok || p.ErrLoc.Raw < start.Raw { errTok = next }
+        d.Diagnostics = append(d.Diagnostics, Diagnostic{
+            Range:    d.tokenRange(errTok),
+            Severity: SeverityError,
+            Source:   "gosp",
+            Message:  msg,
+        })
+
+        // continue after the failed expression
+        skip := d.skipExpr(next)
+        if skip >= len(d.tokens) { break }
+        p.Cursor = start
+        for p.Cursor.Raw < d.tokens[skip].Start {
+            if _, state := p.Cursor.GetChar(&p.Lexer); state == lexer.ReadNone { break }
+        }
+    }
+}
+
+// index of token containing offset, or token just before it (for completion)
+func (d *Document) tokenAt(offset int, before bool) int {
+    i := sort.Search(len(d.tokens), func(i int) bool { return d.tokens[i].End > offset })
+    if i < len(d.tokens) && d.tokens[i].Start <= offset { return i }
+    if before { return i - 1 }
+    return -1
+}
+
+// innermost definition of name visible at token i
+func (d *Document) definition(name string, i int) *symbol {
+    var best *symbol
+    for _, s := range d.symbols {
+        if s.Name != name { continue }
+        if s.NameTok == i { return s }
+        if i < s.ScopeStart || i >= s.ScopeEnd { continue }
+        if best == nil || s.ScopeStart > best.ScopeStart { best = s }
+    }
+    return best
+}
+
+func (d *Document) Hover(pos Position) *Hover {
+    i := d.tokenAt(d.offset(pos), false)
+    if i < 0 || d.tokens[i].Type != lexer.TokenId { return nil }
+    name := d.tokens[i].Str
+
+    var text string
+    if s := d.definition(name, i); s != nil && s.Kind != symbolFunc {
+        text = name + ": " + s.Detail
+        if s.Kind == symbolLet { text = s.Detail }
+    } else if d.gs.FindFunc(name) != nil || parser.FindSpecialForm(name) != nil {
+        text = d.gs.Describe(name)
+    } else {
+        return nil
+    }
+    r := d.tokenRange(i)
+    return &Hover{
+        Contents: MarkupContent{Kind: "markdown", Value: "```gosp\n" + text + "\n```"},
+        Range:    &r,
+    }
+}
+
+func (d *Document) Definition(pos Position) *Location {
+    i := d.tokenAt(d.offset(pos), false)
+    if i < 0 || d.tokens[i].Type != lexer.TokenId { return nil }
+    s := d.definition(d.tokens[i].Str, i)
+    if s == nil { return nil }
+    return &Location{URI: d.URI, Range: d.tokenRange(s.NameTok)}
+}
+
+func (d *Document) Completion(pos Position) []CompletionItem {
+    items := []CompletionItem{}
+    i := d.tokenAt(d.offset(pos), true)
+    seen := map[string]bool{}
+    if i >= 0 {
+        for _, s := range d.symbols {
+            if s.Kind == symbolFunc || i < s.ScopeStart || i >= s.ScopeEnd || seen[s.Name] { continue }
+            seen[s.Name] = true
+            items = append(items, CompletionItem{Label: s.Name, Kind: CompletionVariable, Detail: s.Detail})
+        }
+    }
+    for _, form := range parser.SpecialForms {
+        items = append(items, CompletionItem{
+            Label:         form.Id,
+            Kind:          CompletionKeyword,
+            Detail:        form.Doc.Syntax,
+            Documentation: &MarkupContent{Kind: "plaintext", Value: form.Doc.Description},
+        })
+    }
+    for _, f := range d.gs.Funcs {
+        if seen[f.Id] { continue }
+        item := CompletionItem{Label: f.Id, Kind: CompletionFunction, Detail: f.Type.Signature(f.Id)}
+        if f.Doc.Description != "" {
+            item.Documentation = &MarkupContent{Kind: "plaintext", Value: f.Doc.Description}
+        }
+        items = append(items, item)
+    }
+    return items
+}
+
+// innermost defun or let containing s, nil for top-level
+func (d *Document) parent(s *symbol) *symbol {
+    var best *symbol
+    for _, o := range d.symbols {
+        if o == s || o.Kind == symbolArg { continue }
+        if s.Form > o.Form && s.Form < d.skipExpr(o.Form) && (best == nil || o.Form > best.Form) {
+            best = o
+        }
+    }
+    return best
+}
+
+func (d *Document) documentSymbol(s *symbol) DocumentSymbol {
+    ds := DocumentSymbol{
+        Name:           s.Name,
+        Detail:         s.Detail,
+        Kind:           SymbolVariable,
+        Range:          d.formRange(s.Form),
+        SelectionRange: d.tokenRange(s.NameTok),
+    }
+    if s.Kind == symbolFunc { ds.Kind = SymbolFunction }
+    if s.Kind == symbolArg  { ds.Range = ds.SelectionRange }
+    for _, a := range s.Args {
+        ds.Children = append(ds.Children, d.documentSymbol(a))
+    }
+    for _, o := range d.symbols {
+        if o.Kind != symbolArg && d.parent(o) == s {
+            ds.Children = append(ds.Children, d.documentSymbol(o))
+        }
+    }
+    return ds
+}
+
+func (d *Document) Symbols() []DocumentSymbol {
+    out := []DocumentSymbol{}
+    for _, s := range d.symbols {
+        if s.Kind != symbolArg && d.parent(s) == nil {
+            out = append(out, d.documentSymbol(s))
+        }
+    }
+    return out
+}
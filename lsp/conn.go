@@ -0,0 +1,61 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// larger messages are rejected before their body is read
+var MaxMessageSize = 64 << 20 // 64MB
+
+// JSON-RPC messages framed by Content-Length headers
+type Conn struct {
+    r  *bufio.Reader
+    mu sync.Mutex
+    w  io.Writer
+}
+
+func NewConn(r io.Reader, w io.Writer) *Conn {
+    return &Conn{r: bufio.NewReader(r), w: w}
+}
+
+func (c *Conn) Read() (msg Message, err error) {
+    header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+    if err != nil { return }
+    length, err := strconv.Atoi(header.Get("Content-Length"))
+    if err != nil || length < 0 {
+        return msg, fmt.Errorf("invalid Content-Length: %q", header.Get("Content-Length"))
+    }
+    if length > MaxMessageSize {
+        return msg, fmt.Errorf("message of %d bytes exceeds limit of %d bytes", length, MaxMessageSize)
+    }
+    body := make([]byte, length)
+    if _, err = io.ReadFull(c.r, body); err != nil { return }
+    err = json.Unmarshal(body, &msg)
+    return
+}
+
+func (c *Conn) Write(msg Message) error {
+    msg.JSONRPC = "2.0"
+    body, err := json.Marshal(msg)
+    if err != nil { return err }
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if _, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+        return err
+    }
+    _, err = c.w.Write(body)
+    return err
+}
+
+func (c *Conn) Notify(method string, params any) error {
+    raw, err := json.Marshal(params)
+    if err != nil { return err }
+    return c.Write(Message{Method: method, Params: raw})
+}
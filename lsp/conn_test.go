@@ -0,0 +1,56 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestConnRoundTrip(t *testing.T) {
+    var buf bytes.Buffer
+    c := NewConn(&buf, &buf)
+
+    id := json.RawMessage(`1`)
+    sent := []Message{
+        {ID: &id, Method: "initialize", Params: json.RawMessage(`{"rootUri":"file:///tmp/ü"}`)},
+        {Method: "initialized", Params: json.RawMessage(`{}`)},
+    }
+    for _, msg := range sent {
+        if err := c.Write(msg); err != nil { t.Fatal(err) }
+    }
+    if !strings.HasPrefix(buf.String(), "Content-Length: ") {
+        t.Fatalf("message is not framed: %q", buf.String())
+    }
+
+    for _, want := range sent {
+        got, err := c.Read()
+        if err != nil { t.Fatal(err) }
+        if got.JSONRPC != "2.0" || got.Method != want.Method || string(got.Params) != string(want.Params) {
+            t.Errorf("got %+v, want %+v", got, want)
+        }
+        if (got.ID == nil) != (want.ID == nil) || got.ID != nil && string(*got.ID) != string(*want.ID) {
+            t.Errorf("%s: id differs", want.Method)
+        }
+    }
+}
+
+func TestConnReadInvalid(t *testing.T) {
+    tests := []struct {
+        name  string
+        input string
+    }{
+        {"missing length", "Content-Type: x\r\n\r\n{}"},
+        {"negative length", "Content-Length: -1\r\n\r\n"},
+        {"too large", fmt.Sprintf("Content-Length: %d\r\n\r\n", MaxMessageSize + 1)},
+        {"short body", "Content-Length: 10\r\n\r\n{}"},
+        {"invalid json", "Content-Length: 2\r\n\r\n{]"},
+    }
+    for _, tt := range tests {
+        c := NewConn(strings.NewReader(tt.input), nil)
+        if _, err := c.Read(); err == nil {
+            t.Errorf("%s: expected error", tt.name)
+        }
+    }
+}
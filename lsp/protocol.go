@@ -0,0 +1,130 @@
+package lsp
+
+import "encoding/json"
+
+// Subset of Language Server Protocol 3.17 used by the server.
+
+type Message struct {
+    JSONRPC string           `json:"jsonrpc"`
+    ID      *json.RawMessage `json:"id,omitempty"`
+    Method  string           `json:"method,omitempty"`
+    Params  json.RawMessage  `json:"params,omitempty"`
+    Result  *json.RawMessage `json:"result,omitempty"` // set for responses, may hold null
+    Error   *ResponseError   `json:"error,omitempty"`
+}
+
+type ResponseError struct {
+    Code    int    `json:"code"`
+    Message string `json:"message"`
+}
+
+const (
+    CodeParseError     = -32700
+    CodeInvalidRequest = -32600
+    CodeMethodNotFound = -32601
+    CodeInvalidParams  = -32602
+)
+
+// zero-based, Character counts UTF-16 code units
+type Position struct {
+    Line      int `json:"line"`
+    Character int `json:"character"`
+}
+
+type Range struct {
+    Start Position `json:"start"`
+    End   Position `json:"end"`
+}
+
+type Location struct {
+    URI   string `json:"uri"`
+    Range Range  `json:"range"`
+}
+
+type TextDocumentItem struct {
+    URI     string `json:"uri"`
+    Version int    `json:"version"`
+    Text    string `json:"text"`
+}
+
+type TextDocumentIdentifier struct {
+    URI string `json:"uri"`
+}
+
+type TextDocumentPositionParams struct {
+    TextDocument TextDocumentIdentifier `json:"textDocument"`
+    Position     Position               `json:"position"`
+}
+
+type DidOpenParams struct {
+    TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+type DidChangeParams struct {
+    TextDocument TextDocumentIdentifier `json:"textDocument"`
+    // full sync, last change holds whole text
+    ContentChanges []struct {
+        Text string `json:"text"`
+    } `json:"contentChanges"`
+}
+
+type DidCloseParams struct {
+    TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DocumentSymbolParams struct {
+    TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+const (
+    SeverityError = 1
+)
+
+type Diagnostic struct {
+    Range    Range  `json:"range"`
+    Severity int    `json:"severity"`
+    Source   string `json:"source"`
+    Message  string `json:"message"`
+}
+
+type PublishDiagnosticsParams struct {
+    URI         string       `json:"uri"`
+    Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+type MarkupContent struct {
+    Kind  string `json:"kind"` // plaintext or markdown
+    Value string `json:"value"`
+}
+
+type Hover struct {
+    Contents MarkupContent `json:"contents"`
+    Range    *Range        `json:"range,omitempty"`
+}
+
+const (
+    CompletionFunction = 3
+    CompletionVariable = 6
+    CompletionKeyword  = 14
+)
+
+type CompletionItem struct {
+    Label         string         `json:"label"`
+    Kind          int            `json:"kind"`
+    Detail        string         `json:"detail,omitempty"`
+    Documentation *MarkupContent `json:"documentation,omitempty"`
+}
+
+const (
+    SymbolFunction = 12
+    SymbolVariable = 13
+)
+
+type DocumentSymbol struct {
+    Name           string           `json:"name"`
+    Detail         string           `json:"detail,omitempty"`
+    Kind           int              `json:"kind"`
+    Range          Range            `json:"range"`
+    SelectionRange Range            `json:"selectionRange"`
+    Children       []DocumentSymbol `json:"children,omitempty"`
+}
@@ -0,0 +1,163 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Language server over one connection, documents are fully synced.
+type Server struct {
+    conn *Conn
+
+    mu       sync.Mutex
+    docs     map[string]*Document
+    shutdown bool
+}
+
+func NewServer(conn *Conn) *Server {
+    return &Server{conn: conn, docs: make(map[string]*Document)}
+}
+
+// Runs until exit notification or end of input.
+func Serve(r io.Reader, w io.Writer) error {
+    return NewServer(NewConn(r, w)).Run()
+}
+
+var errExit = errors.New("exit")
+
+func (s *Server) Run() error {
+    for {
+        msg, err := s.conn.Read()
+        if err == io.EOF { return nil }
+        if err != nil { return err }
+
+        err = s.handle(msg)
+        if err == errExit { return nil }
+        if err != nil { return err }
+    }
+}
+
+func (s *Server) reply(id *json.RawMessage, result any, rerr *ResponseError) error {
+    msg := Message{ID: id, Error: rerr}
+    if rerr == nil {
+        raw, err := json.Marshal(result)
+        if err != nil { return err }
+        msg.Result = (*json.RawMessage)(&raw)
+    }
+    return s.conn.Write(msg)
+}
+
+func (s *Server) handle(msg Message) error {
+    isRequest := msg.ID != nil
+    if msg.Method == "" {
+        return nil // response to our request, we send none
+    }
+
+    result, rerr := s.dispatch(msg)
+    if msg.Method == "exit" { return errExit }
+    if !isRequest { return nil }
+    return s.reply(msg.ID, result, rerr)
+}
+
+func decode(params json.RawMessage, v any) *ResponseError {
+    if err := json.Unmarshal(params, v); err != nil {
+        return &ResponseError{Code: CodeInvalidParams, Message: err.Error()}
+    }
+    return nil
+}
+
+func (s *Server) dispatch(msg Message) (result any, rerr *ResponseError) {
+    if s.shutdown && msg.Method != "exit" {
+        return nil, &ResponseError{Code: CodeInvalidRequest, Message: "server is shut down"}
+    }
+
+    switch msg.Method {
+    case "initialize":
+        return map[string]any{
+            "capabilities": map[string]any{
+                "textDocumentSync":       1, // full
+                "hoverProvider":          true,
+                "definitionProvider":     true,
+                "documentSymbolProvider": true,
+                "completionProvider": map[string]any{
+                    "triggerCharacters": []string{"("},
+                },
+            },
+            "serverInfo": map[string]string{"name": "gosp"},
+        }, nil
+    case "initialized", "exit", "$/cancelRequest", "$/setTrace":
+        return nil, nil
+    case "shutdown":
+        s.shutdown = true
+        return nil, nil
+
+    case "textDocument/didOpen":
+        var params DidOpenParams
+        if rerr = decode(msg.Params, &params); rerr != nil { return }
+        td := params.TextDocument
+        s.update(NewDocument(td.URI, td.Version, td.Text))
+    case "textDocument/didChange":
+        var params DidChangeParams
+        if rerr = decode(msg.Params, &params); rerr != nil { return }
+        if n := len(params.ContentChanges); n > 0 {
+            s.update(NewDocument(params.TextDocument.URI, 0, params.ContentChanges[n-1].Text))
+        }
+    case "textDocument/didClose":
+        var params DidCloseParams
+        if rerr = decode(msg.Params, &params); rerr != nil { return }
+        s.mu.Lock()
+        delete(s.docs, params.TextDocument.URI)
+        s.mu.Unlock()
+        s.conn.Notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+            URI: params.TextDocument.URI, Diagnostics: []Diagnostic{},
+        })
+
+    case "textDocument/hover":
+        return s.withDocument(msg, func(d *Document, pos Position) any { return d.Hover(pos) })
+    case "textDocument/definition":
+        return s.withDocument(msg, func(d *Document, pos Position) any { return d.Definition(pos) })
+    case "textDocument/completion":
+        return s.withDocument(msg, func(d *Document, pos Position) any { return d.Completion(pos) })
+    case "textDocument/documentSymbol":
+        var params DocumentSymbolParams
+        if rerr = decode(msg.Params, &params); rerr != nil { return }
+        if d := s.document(params.TextDocument.URI); d != nil {
+            return d.Symbols(), nil
+        }
+        return []DocumentSymbol{}, nil
+
+    default:
+        if msg.ID != nil {
+            rerr = &ResponseError{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+        }
+    }
+    return
+}
+
+func (s *Server) document(uri string) *Document {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.docs[uri]
+}
+
+func (s *Server) update(d *Document) {
+    s.mu.Lock()
+    s.docs[d.URI] = d
+    s.mu.Unlock()
+
+    diags := d.Diagnostics
+    if diags == nil { diags = []Diagnostic{} }
+    s.conn.Notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+        URI: d.URI, Diagnostics: diags,
+    })
+}
+
+func (s *Server) withDocument(msg Message, fn func(*Document, Position) any) (any, *ResponseError) {
+    var params TextDocumentPositionParams
+    if rerr := decode(msg.Params, &params); rerr != nil { return nil, rerr }
+    d := s.document(params.TextDocument.URI)
+    if d == nil { return nil, nil }
+    return fn(d, params.Position), nil
+}
@@ -0,0 +1,70 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+// runs server over scripted input, returns messages it has written
+func serveScript(t *testing.T, msgs ...Message) []Message {
+    t.Helper()
+    var in, out bytes.Buffer
+    script := NewConn(nil, &in)
+    for _, msg := range msgs {
+        if err := script.Write(msg); err != nil { t.Fatal(err) }
+    }
+    if err := Serve(&in, &out); err != nil { t.Fatal(err) }
+
+    var written []Message
+    c := NewConn(&out, nil)
+    for {
+        msg, err := c.Read()
+        if err == io.EOF { break }
+        if err != nil { t.Fatal(err) }
+        written = append(written, msg)
+    }
+    return written
+}
+
+func params(t *testing.T, v any) json.RawMessage {
+    t.Helper()
+    raw, err := json.Marshal(v)
+    if err != nil { t.Fatal(err) }
+    return raw
+}
+
+func TestDidOpenDiagnostics(t *testing.T) {
+    open := func(uri, text string) Message {
+        return Message{Method: "textDocument/didOpen", Params: params(t, DidOpenParams{
+            TextDocument: TextDocumentItem{URI: uri, Version: 1, Text: text},
+        })}
+    }
+    written := serveScript(t,
+        open("file:///bad.gosp", "(+ 1.0 \"x\")\n"),
+        open("file:///good.gosp", "(+ 1.0 2.0)\n"),
+        Message{Method: "exit"})
+    if len(written) != 2 { t.Fatalf("expected 2 notifications, got %d", len(written)) }
+
+    diags := make(map[string][]Diagnostic)
+    for _, msg := range written {
+        if msg.Method != "textDocument/publishDiagnostics" {
+            t.Fatalf("unexpected message %s", msg.Method)
+        }
+        var p PublishDiagnosticsParams
+        if err := json.Unmarshal(msg.Params, &p); err != nil { t.Fatal(err) }
+        if p.Diagnostics == nil { t.Errorf("%s: diagnostics must be an array", p.URI) }
+        diags[p.URI] = p.Diagnostics
+    }
+    bad := diags["file:///bad.gosp"]
+    if len(bad) == 0 {
+        t.Fatal("no diagnostics for bad.gosp")
+    }
+    if bad[0].Message == "" || bad[0].Range.Start.Line != 0 || bad[0].Range.Start.Character != 7 {
+        t.Errorf("unexpected diagnostic %+v", bad[0])
+    }
+    if good := diags["file:///good.gosp"]; len(good) != 0 {
+        t.Errorf("unexpected diagnostics for good.gosp: %+v", good)
+    }
+}
@@ -2,76 +2,350 @@ package main
 
 import (
     "context"
+    "crypto/tls"
+    "embed"
+    "flag"
+    "fmt"
+    "io/fs"
 	"net/http"
     "os"
+    "os/signal"
+    "regexp"
+    "strings"
+    "syscall"
 	"time"
 
     "github.com/Fipaan/gosp/server"
     "github.com/Fipaan/gosp/log"
+    "github.com/Fipaan/gosp/gosptest"
+    "github.com/Fipaan/gosp/lsp"
+    "github.com/Fipaan/gosp/parser"
+    "github.com/Fipaan/gosp/repl"
 )
 
-func ensureEnv(name string) string {
-    val := os.Getenv(name)
-    if val == "" { log.Abortf("%s was not set", name) }
-    return val
-}
-
-func initDB(ctx context.Context) (server.Storage, func(context.Context) error){
-    mongoURI := ensureEnv("MONGO_URI")
-	dbName   := ensureEnv("MONGO_DB")
-    secret   := ensureEnv("AUTH_HMAC_SECRET")
-
-	db, closeFn, err := server.NewStore(ctx, mongoURI, dbName, []byte(secret))
+func initDB(ctx context.Context, cfg *Config) (server.Storage, func(context.Context) error){
+	db, closeFn, err := server.NewStore(ctx, cfg.MongoURI, cfg.MongoDB, []byte(cfg.AuthSecret))
 	if err != nil {
         log.Abortf("Couldn't initialize db: %s", err.Error())
 	}
     return db, closeFn
 }
 
+// loads and validates config, handles -print-config
+func mustLoadConfig(fs *flag.FlagSet, args []string) Config {
+    cfg, printConfig, err := loadConfig(fs, args)
+    if err != nil { log.Abortf("Couldn't load config: %s", err.Error()) }
+    if printConfig { cfg.Print() }
+    if err = cfg.Validate(); err != nil {
+        log.Abortf("Invalid config:\n%s", err.Error())
+    }
+    if printConfig { os.Exit(0) }
+    return cfg
+}
+
+func usage() {
+    log.Eprintf("Usage: gosp [command] [args]\n")
+    log.Eprintf("Commands:\n")
+    log.Eprintf("    serve [flags]                         run HTTP server (default)\n")
+    log.Eprintf("    admin [flags] [-create] <username>    grant admin role to user\n")
+    log.Eprintf("    fmt [-check] [-w] [files...]          format gosp source\n")
+    log.Eprintf("    run [-profile file] <files...>        evaluate files\n")
+    log.Eprintf("    test [flags] [files or dirs...]       run deftest tests\n")
+    log.Eprintf("    repl [files...]                       interactive interpreter with debugger\n")
+    log.Eprintf("    lsp                                   run language server on stdio\n")
+    log.Eprintf("Run `gosp <command> -h` to see flags\n")
+}
+
 func main() {
+    cmd  := "serve"
+    args := os.Args[1:]
+    if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+        cmd, args = args[0], args[1:]
+    }
+    switch cmd {
+    case "serve": serve(args)
+    case "admin": runAdmin(args)
+    case "fmt":   runFmt(args)
+    case "lsp":   runLSP(args)
+    case "repl":  runREPL(args)
+    case "run":   runFiles(args)
+    case "test":  runTests(args)
+    case "help":  usage()
+    default:
+        usage()
+        log.Abortf("unknown command: %s", cmd)
+    }
+}
+
+// stdout belongs to the protocol, diagnostics of server itself go to stderr
+func runLSP(args []string) {
+    fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+    fs.Parse(args)
+    if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+        log.Abortf("lsp: %s", err.Error())
+    }
+}
+
+func runREPL(args []string) {
+    fs := flag.NewFlagSet("repl", flag.ExitOnError)
+    fs.Parse(args)
+    if err := repl.Run(os.Stdin, os.Stdout, fs.Args()); err != nil {
+        log.Abortf("repl: %s", err.Error())
+    }
+}
+
+func runFiles(args []string) {
+    fs := flag.NewFlagSet("run", flag.ExitOnError)
+    profile := fs.String("profile", "", "write pprof profile to `file`, flat table is printed to stderr")
+    fs.Parse(args)
+    if fs.NArg() == 0 {
+        usage()
+        log.Abortf("run: expected at least one file")
+    }
+
+    var pr *parser.Profiler
+    var hook parser.EvalHook
+    if *profile != "" {
+        pr = parser.NewProfiler()
+        hook = pr
+    }
+    failed, err := repl.RunFiles(os.Stdout, fs.Args(), hook)
+    if err != nil { log.Abortf("run: %s", err.Error()) }
+
+    if pr != nil {
+        pr.WriteTable(os.Stderr)
+        f, err := os.Create(*profile)
+        if err != nil { log.Abortf("run: %s", err.Error()) }
+        if err = pr.WritePprof(f); err == nil { err = f.Close() }
+        if err != nil { log.Abortf("run: couldn't write profile: %s", err.Error()) }
+    }
+    if failed { os.Exit(1) }
+}
+
+// exit status is 1 when some test fails
+func runTests(args []string) {
+    fs := flag.NewFlagSet("test", flag.ExitOnError)
+    run := fs.String("run", "", "run only tests with names matching `regexp`")
+    format := fs.String("format", "text", "report format: text, json or junit")
+    output := fs.String("o", "", "write report to `file` instead of stdout")
+    timeout := fs.Duration("timeout", 10*time.Second, "time limit of each test, 0 for none")
+    verbose := fs.Bool("v", false, "list passed tests too (text format)")
+    fs.Parse(args)
+
+    var opts gosptest.Options
+    opts.Timeout = *timeout
+    if *run != "" {
+        re, err := regexp.Compile(*run)
+        if err != nil { log.Abortf("test: invalid -run: %s", err.Error()) }
+        opts.Run = re
+    }
+    switch *format {
+    case "text", "json", "junit":
+    default: log.Abortf("test: unknown format `%s`", *format)
+    }
+
+    paths := fs.Args()
+    if len(paths) == 0 { paths = []string{"."} }
+    files, err := gosptest.FindFiles(paths)
+    if err != nil { log.Abortf("test: %s", err.Error()) }
+    if len(files) == 0 { log.Abortf("test: no .gosp files found") }
+
+    report := gosptest.Run(files, opts)
+
+    out := os.Stdout
+    if *output != "" {
+        out, err = os.Create(*output)
+        if err != nil { log.Abortf("test: %s", err.Error()) }
+    }
+    switch *format {
+    case "text":  report.WriteText(out, *verbose)
+    case "json":  err = report.WriteJSON(out)
+    case "junit": err = report.WriteJUnit(out)
+    }
+    if err == nil && out != os.Stdout { err = out.Close() }
+    if err != nil { log.Abortf("test: couldn't write report: %s", err.Error()) }
+    if *output != "" && *format != "text" {
+        report.WriteText(os.Stdout, false)
+    }
+    if report.Failed > 0 { os.Exit(1) }
+}
+
+func serve(args []string) {
+    cfg := mustLoadConfig(flag.NewFlagSet("serve", flag.ExitOnError), args)
+    server.MaxBodyBytes = cfg.MaxBodyBytes
+    // format and level are checked by Validate
+    format, _ := log.ParseFormat(cfg.LogFormat)
+    level, _  := log.ParseLevel(cfg.LogLevel)
+    err := log.Configure(log.Options{
+        Level:      level,
+        Format:     format,
+        File:       cfg.LogFile,
+        MaxSize:    cfg.LogMaxSize,
+        MaxBackups: cfg.LogMaxBackups,
+    })
+    if err != nil { log.Abortf("Couldn't open log file: %s", err.Error()) }
+
+    // errors are reported after storage is closed
+    if err := run(&cfg); err != nil {
+        log.Abortf("%s", err.Error())
+    }
+}
+
+//go:embed public
+var embeddedPublic embed.FS
+
+// embedded UI, or publicDir when set (files are reloaded for development)
+func uiFiles(cfg *Config) *server.Static {
+    if cfg.PublicDir != "" {
+        return server.NewStatic(os.DirFS(cfg.PublicDir), true)
+    }
+    ui, err := fs.Sub(embeddedPublic, "public")
+    if err != nil { log.Abortf("embedded public: %s", err.Error()) }
+    return server.NewStatic(ui, false)
+}
+
+func routes(sv *server.Server, cfg *Config) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/register",
+		sv.LimitIP("register", sv.Limits.RegisterIP, sv.HandleRegister))
+	mux.HandleFunc("/api/login",
+		sv.LimitIP("login", sv.Limits.LoginIP, sv.HandleLogin))
+	mux.HandleFunc("/api/expr", sv.HandleExpr)
+	mux.HandleFunc("/api/functions", sv.HandleFunctions)
+	mux.HandleFunc("/api/format", sv.HandleFormat)
+	mux.HandleFunc("/metrics", sv.HandleMetrics)
+	mux.HandleFunc("/healthz", sv.HandleHealthz)
+	mux.HandleFunc("/readyz", sv.HandleReadyz)
+
+    static := uiFiles(cfg)
+    mux.Handle("/", static)
+    // snippet permalink, page loads snippet by id from its own URL
+    mux.HandleFunc("/s/{id}", func(w http.ResponseWriter, r *http.Request) {
+        static.ServeFile(w, r, "snippet.html")
+    })
+
+	mux.HandleFunc("/api/logout", sv.RequireAuth(sv.HandleLogout))
+	mux.HandleFunc("/api/history", sv.RequireScope(server.ScopeHistoryRead, sv.HandleHistory))
+	mux.HandleFunc("/api/account", sv.RequireSession(sv.HandleAccount))
+	mux.HandleFunc("/api/account/password", sv.RequireSession(sv.HandleAccountPassword))
+	mux.HandleFunc("/api/sessions", sv.RequireSession(sv.HandleSessions))
+	mux.HandleFunc("/api/sessions/{id}", sv.RequireSession(sv.HandleSessionRevoke))
+	mux.HandleFunc("/api/tokens", sv.RequireSession(sv.HandleTokens))
+	mux.HandleFunc("/api/tokens/{id}", sv.RequireSession(sv.HandleTokenRevoke))
+	mux.HandleFunc("/api/snippets", sv.RequireAuth(sv.HandleSnippets))
+	mux.HandleFunc("/api/snippets/{id}", sv.HandleSnippet)
+	mux.HandleFunc("/api/snippets/{id}/fork", sv.RequireScope(server.ScopeEval, sv.HandleSnippetFork))
+
+	mux.HandleFunc("/api/admin/users", sv.RequireAdmin(sv.HandleAdminUsers))
+	mux.HandleFunc("/api/admin/users/{username}/disable", sv.RequireAdmin(sv.HandleAdminDisable))
+	mux.HandleFunc("/api/admin/users/{username}/role", sv.RequireAdmin(sv.HandleAdminRole))
+	mux.HandleFunc("/api/admin/users/{username}/sessions", sv.RequireAdmin(sv.HandleAdminLogout))
+	mux.HandleFunc("/api/admin/stats", sv.RequireAdmin(sv.HandleAdminStats))
+	mux.HandleFunc("/api/admin/interps", sv.RequireAdmin(sv.HandleAdminInterps))
+	mux.HandleFunc("/api/admin/audit", sv.RequireAdmin(sv.HandleAdminAudit))
+	mux.HandleFunc("/api/", server.HandleAPINotFound)
+
+	return sv.AccessLog(sv.CORS(mux))
+}
+
+func run(cfg *Config) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-    db, closeFn := initDB(ctx)
+    db, closeFn := initDB(ctx, cfg)
 	
 	defer func() {
-		cctx, ccancel := context.WithTimeout(context.Background(), 5*time.Second)
+		cctx, ccancel := context.WithTimeout(context.Background(), time.Duration(cfg.DBTimeout))
 		defer ccancel()
-		_ = closeFn(cctx)
+		if err := closeFn(cctx); err != nil {
+			log.Errorf("Couldn't close db: %s", err.Error())
+		}
 	}()
 
 	sv := &server.Server{
-        DB:         &db,
-	    CookieName: "authKey",
-        AuthTTL:    30 * 24 * time.Hour,
-	    Addr:       ":8000",
+        DB:          &db,
+	    CookieName:  cfg.CookieName,
+        AuthTTL:     time.Duration(cfg.AuthTTL),
+	    Addr:        cfg.Addr,
+        DBTimeout:   time.Duration(cfg.DBTimeout),
+        EvalTimeout: time.Duration(cfg.EvalTimeout),
+        Limits:      cfg.Limits,
+        StartedAt:   time.Now(),
+        CORSOrigins: cfg.CORSOrigins,
+        TrustProxy:  cfg.TrustProxy,
+        HSTSMaxAge:  time.Duration(cfg.TLS.HSTSMaxAge),
+
+        AuditRetention: time.Duration(cfg.AuditRetention),
     }
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/api/register", sv.HandleRegister)
-	mux.HandleFunc("/api/login", sv.HandleLogin)
-	mux.HandleFunc("/api/expr", sv.HandleExpr)
+    httpSrv := &http.Server{
+        Addr:              sv.Addr,
+        Handler:           routes(sv, cfg),
+        ReadHeaderTimeout: time.Duration(cfg.HTTP.ReadHeaderTimeout),
+        ReadTimeout:       time.Duration(cfg.HTTP.ReadTimeout),
+        WriteTimeout:      time.Duration(cfg.HTTP.WriteTimeout),
+        IdleTimeout:       time.Duration(cfg.HTTP.IdleTimeout),
+        MaxHeaderBytes:    cfg.HTTP.MaxHeaderBytes,
+        TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+    }
+    useTLS := cfg.TLS.CertFile != "" || cfg.TLS.SelfSigned
+    if cfg.TLS.SelfSigned {
+        cert, err := selfSignedCert()
+        if err != nil { return fmt.Errorf("couldn't generate certificate: %w", err) }
+        httpSrv.TLSConfig.Certificates = []tls.Certificate{cert}
+        log.Infof("Using self-signed certificate, don't use it in production")
+    }
 
-    mux.Handle("/",
-        http.StripPrefix("/",
-            http.FileServer(http.Dir("./public")),
-        ),
-    )
+    sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
 
-	mux.HandleFunc("/api/logout", sv.RequireAuth(sv.HandleLogout))
-	mux.HandleFunc("/api/history", sv.RequireAuth(sv.HandleHistory))
-
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if rec := recover(); rec != nil {
-				server.WriteAPIError(w, http.StatusInternalServerError, nil, "internal server error")
-			}
-			log.Printf("[%s] %s %s\n", time.Now().Format(time.RFC3339),
-                      r.Method, r.URL.Path)
-		}()
-		mux.ServeHTTP(w, r)
-	})
-
-	log.Infof("Listening on %s", sv.Addr)
-	log.Abortf("%s", http.ListenAndServe(sv.Addr, handler))
+    errCh := make(chan error, 1)
+    go func() {
+        if useTLS {
+            errCh <- httpSrv.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+        } else {
+            errCh <- httpSrv.ListenAndServe()
+        }
+    }()
+    if useTLS {
+	    log.Infof("Listening on %s (TLS)", sv.Addr)
+    } else {
+	    log.Infof("Listening on %s", sv.Addr)
+    }
+
+    select {
+    case err := <-errCh:
+        return err
+    case <-sigCtx.Done():
+    }
+    // second signal kills the process
+    stop()
+
+    sv.StartDraining()
+    if delay := time.Duration(cfg.HTTP.DrainDelay); delay > 0 {
+        log.Infof("Draining, still serving requests for %s", delay)
+        time.Sleep(delay)
+    }
+
+    timeout := time.Duration(cfg.HTTP.ShutdownTimeout)
+    log.Infof("Shutting down, waiting up to %s for running requests", timeout)
+    shutdown(httpSrv, sv, timeout)
+    log.Infof("Server stopped")
+    return nil
+}
+
+func shutdown(httpSrv *http.Server, sv *server.Server, timeout time.Duration) {
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+
+    // evaluations are interrupted a bit earlier, so they still can respond
+    evalTimer := time.AfterFunc(timeout * 3 / 4, sv.CancelEvaluations)
+    defer evalTimer.Stop()
+
+    if err := httpSrv.Shutdown(ctx); err != nil {
+        log.Errorf("Couldn't drain connections: %s", err.Error())
+        httpSrv.Close()
+    }
+    sv.CancelEvaluations()
+    sv.Close()
 }
@@ -0,0 +1,45 @@
+package parser
+
+import (
+    "fmt"
+    "runtime"
+    "path/filepath"
+
+    "github.com/Fipaan/gosp/lexer"
+)
+
+// Bug of interpreter, e.g. unexpected kind of expression.
+// Evaluation is stopped through gs.Err instead of exiting the process.
+type InternalError struct {
+    Msg   string
+    Where string // file:line where it was detected
+}
+
+func (e *InternalError) Error() string {
+    return fmt.Sprintf("internal error: %s (at %s)", e.Msg, e.Where)
+}
+
+func internalErr(skip int, format string, args ...any) *InternalError {
+    err := &InternalError{Msg: fmt.Sprintf(format, args...), Where: "?"}
+    if _, file, line, ok := runtime.Caller(skip + 1); ok {
+        err.Where = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+    }
+    return err
+}
+
+// Stops evaluation with InternalError, returns nothing for convenience
+func (gs *GospState) Internalf(format string, args ...any) Expr {
+    if gs.Err == nil { gs.Err = internalErr(1, format, args...) }
+    return Expr{Kind: ExprNone}
+}
+
+// Function calls are nested deeper than GospState.MaxDepth,
+// e.g. endless recursion. Stops evaluation through gs.Err
+type DepthError struct {
+    Loc   lexer.Location // of call which exceeded the limit
+    Limit int
+}
+
+func (e *DepthError) Error() string {
+    return fmt.Sprintf("maximum call depth of %d exceeded", e.Limit)
+}
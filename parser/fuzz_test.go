@@ -0,0 +1,53 @@
+package parser
+
+import (
+    "testing"
+
+    "github.com/Fipaan/gosp/lexer"
+)
+
+var fuzzSeeds = []string{
+    "",
+    "(+ 1.0 2.0) (- 10.0 -2.5) (* 2.0 \"x\")",
+    "(let x 2.0 (let y 3.0 (+ x y))) (let x 2.0 (let x 3.0 x)) x",
+    "(defun sq (x double) \"Squares x\" (* x x)) (sq 3.0) (sq \"s\") (sq 1.0 2.0)",
+    "(defun bad (x double x double) x) (defun typ (x float) x) (defun greet () \"hi\")",
+    "[1.0 2.0] [] [[1.0] [2.0] [\"c\"]] [1.0 \"b\"] (head []) (map head [[1.0]])",
+    "(help sq) (describe let) (describe nothing) (profile (+ 1.0 2.0))",
+    "(deftest t (assert (< 1.0 2.0)) (assert-equal 1.0 2.0 \"msg\")) (deftest t)",
+    "(foo 1.0) (head) ((( ))) ] ) #",
+}
+
+// Parses whole input like REPL does. Successful parse must make progress
+// and keep scope of bindings, failed one must restore cursor and bindings.
+func FuzzParseExpr(f *testing.F) {
+    for _, seed := range fuzzSeeds {
+        f.Add(seed)
+    }
+    f.Fuzz(func(t *testing.T, src string) {
+        p := ParserInit()
+        p.AddSourceNamed("fuzz", src)
+        gs := GospInit()
+        bindings := len(gs.Bindings)
+
+        for i := 0; ; i++ {
+            if i > len(src) { t.Fatalf("more expressions than characters") }
+            if p.SkipSpaces(true) != lexer.ReadOk { break }
+            start := p.Cursor
+            _, ok := p.ParseExpr(&gs)
+            if len(gs.Bindings) != bindings {
+                t.Fatalf("expression at %s left %d bindings", start.Loc(), len(gs.Bindings) - bindings)
+            }
+            if !ok {
+                if p.Cursor != start {
+                    t.Fatalf("failed expression at %s moved cursor to %s", start.Loc(), p.Cursor.Loc())
+                }
+                if !p.SkipExpr() { break }
+                continue
+            }
+            if p.Cursor.Raw <= start.Raw && p.Cursor.SourceIndex == start.SourceIndex {
+                t.Fatalf("expression at %s made no progress", start.Loc())
+            }
+        }
+    })
+}
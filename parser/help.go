@@ -0,0 +1,211 @@
+package parser
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/Fipaan/gosp/lexer"
+)
+
+// Forms which are parsed by the parser itself, not by Function.Impl
+type SpecialForm struct {
+    Id  string
+    Doc FuncDoc
+}
+
+var SpecialForms = []SpecialForm{
+    {
+        Id: "let",
+        Doc: FuncDoc{
+            Syntax:      "(let name value body)",
+            Description: "Binds value to name while body is evaluated.",
+            Examples:    []string{"(let x 2.0 (* x x))"},
+        },
+    },
+    {
+        Id: "defun",
+        Doc: FuncDoc{
+            Syntax:      "(defun name (arg type ...) [\"docstring\"] body)",
+            Description: "Defines function, types are: int, double, str, bool, list, id, function.",
+            Examples:    []string{"(defun area (r double) \"Area of a circle\" (* 3.14159 r r))"},
+        },
+    },
+    {
+        Id: "help",
+        Doc: FuncDoc{
+            Syntax:      "(help [name])",
+            Description: "Describes function, special form or binding, lists functions without name.",
+            Examples:    []string{"(help map)", "(help)"},
+        },
+    },
+    {
+        Id: "describe",
+        Doc: FuncDoc{
+            Syntax:      "(describe name)",
+            Description: "Same as help.",
+            Examples:    []string{"(describe +)"},
+        },
+    },
+    {
+        Id: "profile",
+        Doc: FuncDoc{
+            Syntax:      "(profile expr)",
+            Description: "Evaluates expr, returns its result with call counts and time spent in functions.",
+            Examples:    []string{"(profile (map sq [1.0 2.0 3.0]))"},
+        },
+    },
+    {
+        Id: "assert",
+        Doc: FuncDoc{
+            Syntax:      "(assert cond [\"message\"])",
+            Description: "Stops evaluation with failure unless cond is true.",
+            Examples:    []string{"(assert (< 1.0 2.0))"},
+        },
+    },
+    {
+        Id: "assert-equal",
+        Doc: FuncDoc{
+            Syntax:      "(assert-equal expected actual [\"message\"])",
+            Description: "Stops evaluation with failure unless values are equal.",
+            Examples:    []string{"(assert-equal 4.0 (* 2.0 2.0))"},
+        },
+    },
+    {
+        Id: "deftest",
+        Doc: FuncDoc{
+            Syntax:      "(deftest name body ...)",
+            Description: "Defines test, its body is evaluated only by `gosp test`.",
+            Examples:    []string{"(deftest square (assert-equal 9.0 (* 3.0 3.0)))"},
+        },
+    },
+}
+
+func FindSpecialForm(id string) *SpecialForm {
+    for i := 0; i < len(SpecialForms); i++ {
+        if SpecialForms[i].Id == id { return &SpecialForms[i] }
+    }
+    return nil
+}
+
+func (gs *GospState) FindFunc(id string) *Function {
+    for i := 0; i < len(gs.Funcs); i++ {
+        if gs.Funcs[i].Id == id { return &gs.Funcs[i] }
+    }
+    return nil
+}
+
+// special forms, except let and defun, are shadowed by functions of the same name,
+// so programs written before the form was added keep working
+func (gs *GospState) Shadowed(form string) bool {
+    return gs.FindFunc(form) != nil
+}
+
+func reservedForm(id string) bool {
+    return id == "let" || id == "defun"
+}
+
+func (doc FuncDoc) write(b *strings.Builder) {
+    if doc.Description != "" {
+        b.WriteString("\n")
+        b.WriteString(doc.Description)
+    }
+    for _, ex := range doc.Examples {
+        b.WriteString("\nExample: ")
+        b.WriteString(ex)
+    }
+}
+
+// Text shown by help for id, innermost binding wins as in evaluation
+func (gs *GospState) Describe(id string) string {
+    var b strings.Builder
+    for i := len(gs.Bindings) - 1; i >= 0; i-- {
+        if gs.Bindings[i].Id != id { continue }
+        val := gs.Bindings[i].Val
+        fmt.Fprintf(&b, "%s: %s (binding)", id, val.GetExprType().SimpType().Name())
+        return b.String()
+    }
+    if f := gs.FindFunc(id); f != nil {
+        b.WriteString(f.Type.Signature(f.Id))
+        if f.Doc.Syntax != "" {
+            fmt.Fprintf(&b, "\nSyntax: %s", f.Doc.Syntax)
+        }
+        f.Doc.write(&b)
+        return b.String()
+    }
+    if form := FindSpecialForm(id); form != nil {
+        fmt.Fprintf(&b, "%s (special form)", form.Doc.Syntax)
+        form.Doc.write(&b)
+        return b.String()
+    }
+    return fmt.Sprintf("`%s` is not defined", id)
+}
+
+// names of special forms and functions
+func (gs *GospState) HelpIndex() string {
+    var b strings.Builder
+    b.WriteString("Special forms:")
+    for _, form := range SpecialForms {
+        b.WriteString(" ")
+        b.WriteString(form.Id)
+    }
+    b.WriteString("\nFunctions:")
+    for _, f := range gs.Funcs {
+        b.WriteString(" ")
+        b.WriteString(f.Id)
+    }
+    b.WriteString("\nUse (help name) to describe one of them")
+    return b.String()
+}
+
+// (help [name]) or (describe name), described at evaluation,
+// so bindings show their values' types
+func (p *Parser) ParseHelp(gs *GospState) (expr Expr, ok, validObj bool) {
+    var ttype lexer.TokenType
+    var form, id string
+    var loc      lexer.Location
+    savedCur := p.Cursor
+    savedBindings := gs.Bindings
+    ok = p.ParseAndExpect(lexer.TokenOParen)
+    if !ok { goto restore }
+    loc = p.TokenLoc
+    ok  = p.ParseAndExpect(lexer.TokenId)
+    if !ok { goto restore }
+    if p.Str != "help" && p.Str != "describe" || gs.Shadowed(p.Str) {
+        p.ExpectedErr("help", p.Str)
+        ok = false
+        goto restore
+    }
+    form = p.Str
+    validObj = true
+
+    ttype, ok = p.PeekToken()
+    if ok && ttype == lexer.TokenId {
+        p.GetToken()
+        id = p.Str
+    } else if form == "describe" {
+        ok = p.ParseAndExpect(lexer.TokenId)
+        goto restore
+    }
+    ok = p.ParseAndExpect(lexer.TokenCParen)
+    if !ok { goto restore }
+
+    expr = Expr{
+        Kind: ExprFunc,
+        Loc:  loc,
+        Func: Function{
+            Id:   form,
+            Type: FuncType{RType: &ExprType{Kind: ExprStr}},
+            Impl: func(gs *GospState, args []Expr) Expr {
+                if id == "" {
+                    return Expr{Kind: ExprStr, Str: gs.HelpIndex()}
+                }
+                return Expr{Kind: ExprStr, Str: gs.Describe(id)}
+            },
+        },
+    }
+    return
+restore:
+    p.Cursor = savedCur
+    gs.Bindings = savedBindings
+    return
+}
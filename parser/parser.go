@@ -1,17 +1,24 @@
 package parser
 
 import (
-    "github.com/Fipaan/gosp/log"
     "github.com/Fipaan/gosp/lexer"
+    "context"
     "fmt"
+    "strings"
 )
 
 type Parser struct {
     lexer.Lexer
+
+    depth int // of lists and calls being parsed
 }
 
+// deeper source is rejected, parsing it could overflow the stack
+const MaxNesting = 1000
+var errTooDeep = fmt.Errorf("expression is nested deeper than %d levels", MaxNesting)
+
 func ParserInit() Parser {
-    return Parser{lexer.LexerInit()}
+    return Parser{Lexer: lexer.LexerInit()}
 }
 
 func (p *Parser) GetToken() (Type lexer.TokenType, ok bool) {
@@ -113,6 +120,7 @@ type Expr struct {
     
     Func   Function
     Args   []Expr
+    Loc    lexer.Location // of function call or token
     
     List   []Expr
 
@@ -121,7 +129,7 @@ type Expr struct {
     LetBody *Expr
 }
 func (p *Parser) Token2Expr(gs *GospState, Type lexer.TokenType) (Expr, bool) {
-    expr := Expr{Kind: Token2ExprKind(Type)}
+    expr := Expr{Kind: Token2ExprKind(Type), Loc: p.TokenLoc}
     if expr.Kind == ExprNone { return expr, false }
     switch expr.Kind {
         case ExprId:     expr.Id     = p.Str
@@ -129,7 +137,9 @@ func (p *Parser) Token2Expr(gs *GospState, Type lexer.TokenType) (Expr, bool) {
         case ExprInt:    expr.Int    = p.Int
         case ExprDouble: expr.Double = p.Double
         case ExprBool:   expr.Bool   = p.Bool
-        default: log.Unreachable("unexpected expression type: %s", expr.Kind.Str())
+        default:
+            p.SetErr(internalErr(0, "unexpected expression type: %s", expr.Kind.Str()))
+            return expr, false
     }
     return expr, true
 }
@@ -158,16 +168,44 @@ func (expr *Expr) GetExprType() ExprType {
             return expr.LetBody.GetExprType()
         }
         EType.Kind = ExprNone
-    default: log.Unreachable("unknown expr type: %s", EType.Kind.Str())
+    // unknown kinds are reported by Eval
     }
     return EType
 }
 func (expr *Expr) Eval(gs *GospState) Expr {
     rexpr := *expr
     switch (expr.Kind) {
-    case ExprFunc:   rexpr = expr.Func.Impl(gs, expr.Args)
+    case ExprFunc:
+        if gs.Interrupted() { return Expr{Kind: ExprNone} }
+        // Go can't recover from stack overflow, so recursion is stopped before it
+        if limit := gs.maxDepth(); gs.depth >= limit {
+            gs.Err = &DepthError{Loc: expr.Loc, Limit: limit}
+            return Expr{Kind: ExprNone}
+        }
+        gs.depth += 1
+        defer func() { gs.depth -= 1 }()
+        if gs.Hook == nil {
+            rexpr = expr.Func.Impl(gs, expr.Args)
+            break
+        }
+        // arguments are evaluated before the call, so hook can see them
+        gs.Hook.Enter(gs, expr)
+        args := make([]Expr, len(expr.Args))
+        for i := 0; i < len(expr.Args) && !gs.Interrupted(); i++ {
+            args[i] = expr.Args[i].Eval(gs)
+        }
+        if !gs.Interrupted() { gs.Hook.Call(gs, expr, args) }
+        if gs.Interrupted() {
+            rexpr = Expr{Kind: ExprNone}
+        } else {
+            rexpr = expr.Func.Impl(gs, args)
+        }
+        gs.Hook.Exit(gs, expr, rexpr)
     case ExprList:
-        for i := 0; i < len(rexpr.List); i++ {
+        if gs.Interrupted() { return Expr{Kind: ExprNone} }
+        // new slice, parsed list is evaluated again on next call
+        rexpr.List = make([]Expr, len(expr.List))
+        for i := 0; i < len(rexpr.List) && !gs.Interrupted(); i++ {
             rexpr.List[i] = expr.List[i].Eval(gs)
         }
     case ExprNone:   fallthrough
@@ -176,9 +214,11 @@ func (expr *Expr) Eval(gs *GospState) Expr {
     case ExprDouble: fallthrough
     case ExprBool:   break
     case ExprId:
+        // bound values are evaluated already, evaluating them again
+        // would never end for id bound to itself, e.g. (let y y y)
         for i := 0; i <  len(gs.Bindings); i++ {
             if gs.Bindings[i].Id == expr.Id {
-                return gs.Bindings[i].Val.Eval(gs)
+                return gs.Bindings[i].Val
             }
         }
         break
@@ -192,36 +232,44 @@ func (expr *Expr) Eval(gs *GospState) Expr {
         result := expr.LetBody.Eval(gs)
         gs.Bindings = saved
         return result
-    default: log.Unreachable("unknown expr type: %s", expr.Kind.Str())
+    default: return gs.Internalf("unknown expr type: %s", expr.Kind.Str())
     }
     return rexpr
 }
 func (expr *Expr) ToStr(gs *GospState) string {
     rexpr := expr.Eval(gs)
-    switch (rexpr.Kind) {
-    case ExprNone: return "undefined"
+    var b strings.Builder
+    rexpr.writeStr(gs, &b)
+    return b.String()
+}
+// value is evaluated already, so elements of list are not evaluated again
+func (val *Expr) writeStr(gs *GospState, b *strings.Builder) {
+    switch (val.Kind) {
+    case ExprNone: b.WriteString("undefined")
     case ExprFunc:
-        log.Unreachable("unexpected expr type: %s", rexpr.Kind.Str())
+        gs.Internalf("unexpected expr type: %s", val.Kind.Str())
     case ExprList:
-        res := "["
-        for i := 0; i < len(rexpr.List); i++ {
-            if i > 0 { res += " " }
-            res += rexpr.List[i].ToStr(gs)
-        }
-        res += "]"
-        return res
-    case ExprId:  return rexpr.Id
-    case ExprStr: return rexpr.Str
+        b.WriteString("[")
+        for i := 0; i < len(val.List); i++ {
+            if gs.Interrupted() { return }
+            if i > 0 { b.WriteString(" ") }
+            val.List[i].writeStr(gs, b)
+        }
+        b.WriteString("]")
+    case ExprId:  b.WriteString(val.Id)
+    case ExprStr: b.WriteString(val.Str)
     case ExprInt:
-        return fmt.Sprintf("%d", rexpr.Int)
+        fmt.Fprintf(b, "%d", val.Int)
     case ExprDouble:
-        return fmt.Sprintf("%f", rexpr.Double)
+        fmt.Fprintf(b, "%f", val.Double)
     case ExprBool:
-        if rexpr.Bool { return "true" }
-        return "false"
-    default: log.Unreachable("unknown expr type: %s", rexpr.Kind.Str())
+        if val.Bool {
+            b.WriteString("true")
+        } else {
+            b.WriteString("false")
+        }
+    default: gs.Internalf("unknown expr type: %s", val.Kind.Str())
     }
-    return ""
 }
 type FuncType struct {
     Types []ExprType
@@ -236,10 +284,47 @@ type ExprType struct {
 func (et ExprType) Str() string {
     return fmt.Sprintf("%s argument", et.Kind.Str())
 }
+// Readable name of type: double, [double], function
+func (et ExprType) Name() string {
+    switch et.Kind {
+    case ExprNone: return "any"
+    case ExprList:
+        if et.List == nil { return "list" }
+        return "[" + et.List.Name() + "]"
+    }
+    return et.Kind.Str()
+}
+// can be called with one argument, e.g. by map
+func (ft FuncType) Unary() bool {
+    if ft.VType != nil { return len(ft.Types) <= 1 }
+    return len(ft.Types) == 1
+}
+// (name double double...) -> double
+func (ft FuncType) Signature(id string) string {
+    sig := "(" + id
+    for _, t := range ft.Types {
+        sig += " " + t.Name()
+    }
+    if ft.VType != nil {
+        sig += " " + ft.VType.Name() + "..."
+    }
+    sig += ")"
+    if ft.RType != nil {
+        sig += " -> " + ft.RType.Name()
+    }
+    return sig
+}
+type FuncDoc struct {
+    Syntax      string
+    Description string
+    Examples    []string
+}
 type Function struct {
-    Id    string
-    Type  FuncType
-    Impl  func(*GospState, []Expr) Expr
+    Id      string
+    Type    FuncType
+    Impl    func(*GospState, []Expr) Expr
+    Doc     FuncDoc
+    Builtin bool
 }
 type Binding struct {
     Id  string
@@ -249,15 +334,59 @@ type NamedArg struct {
     Id   string
     Type ExprType
 }
+// Observes function calls during evaluation, see Tracer.
+// Hook may stop evaluation by setting gs.Err.
+type EvalHook interface {
+    Enter(gs *GospState, call *Expr)              // before arguments are evaluated
+    Call(gs *GospState, call *Expr, args []Expr)  // function is about to run
+    Exit(gs *GospState, call *Expr, result Expr)  // after each Enter
+}
+// several hooks, Exit is called in reverse order
+type Hooks []EvalHook
+func (hs Hooks) Enter(gs *GospState, call *Expr) {
+    for _, h := range hs { h.Enter(gs, call) }
+}
+func (hs Hooks) Call(gs *GospState, call *Expr, args []Expr) {
+    for _, h := range hs { h.Call(gs, call, args) }
+}
+func (hs Hooks) Exit(gs *GospState, call *Expr, result Expr) {
+    for i := len(hs) - 1; i >= 0; i-- { hs[i].Exit(gs, call, result) }
+}
 type GospState struct {
     Funcs    []Function
     Bindings []Binding
+    Tests    []Test
+
+    Ctx      context.Context // optional, evaluation stops once it is done
+    Err      error           // reason evaluation was stopped
+    Hook     EvalHook        // optional
+    MaxDepth int             // of nested function calls, DefaultMaxDepth when zero
+
+    depth    int
+}
+const DefaultMaxDepth = 1000
+func (gs *GospState) maxDepth() int {
+    if gs.MaxDepth > 0 { return gs.MaxDepth }
+    return DefaultMaxDepth
+}
+// Checks whether evaluation should stop, reason is kept in gs.Err
+func (gs *GospState) Interrupted() bool {
+    if gs.Err == nil && gs.Ctx != nil {
+        gs.Err = gs.Ctx.Err()
+    }
+    return gs.Err != nil
 }
 func GospInit() GospState {
     return GospState {
         Funcs:[]Function {
             Function{
                 Id: "+",
+                Builtin: true,
+                Doc: FuncDoc{
+                    Syntax:      "(+ a b ...)",
+                    Description: "Adds all arguments.",
+                    Examples:    []string{"(+ 1.2 2.3 3.4)"},
+                },
                 Type: FuncType{
                     VType: &ExprType{Kind: ExprDouble},
                     RType: &ExprType{Kind: ExprDouble},
@@ -272,6 +401,12 @@ func GospInit() GospState {
             },
             Function{
                 Id: "-",
+                Builtin: true,
+                Doc: FuncDoc{
+                    Syntax:      "(- a b)",
+                    Description: "Subtracts second from first.",
+                    Examples:    []string{"(- 10.5 3.2)"},
+                },
                 Type: FuncType{
                     Types: []ExprType{
                         ExprType{Kind: ExprDouble},
@@ -287,6 +422,12 @@ func GospInit() GospState {
             },
             Function{
                 Id: "*",
+                Builtin: true,
+                Doc: FuncDoc{
+                    Syntax:      "(* a b ...)",
+                    Description: "Multiplies arguments.",
+                    Examples:    []string{"(* 2.1 3.5 4.0)"},
+                },
                 Type: FuncType{
                     VType: &ExprType{Kind: ExprDouble},
                     RType: &ExprType{Kind: ExprDouble},
@@ -301,6 +442,12 @@ func GospInit() GospState {
             },
             Function{
                 Id: "/",
+                Builtin: true,
+                Doc: FuncDoc{
+                    Syntax:      "(/ a b)",
+                    Description: "Divides first by second, division by zero gives 0.",
+                    Examples:    []string{"(/ 8.2 2.1)"},
+                },
                 Type: FuncType{
                     Types: []ExprType{
                         ExprType{Kind: ExprDouble},
@@ -318,6 +465,12 @@ func GospInit() GospState {
             },
             Function{
                 Id: "map",
+                Builtin: true,
+                Doc: FuncDoc{
+                    Syntax:      "(map f list)",
+                    Description: "Applies function named f to each element of list.",
+                    Examples:    []string{"(defun sq (x double) (* x x))", "(map sq [1.0 2.0 3.0])"},
+                },
                 Type: FuncType{
                     Types: []ExprType{
                         ExprType{Kind: ExprId},
@@ -333,17 +486,25 @@ func GospInit() GospState {
                             break
                         }
                     }
-                    if Func == nil { return Expr{Kind: ExprList, List: []Expr{}} }
+                    // arity is checked by parser, builtins don't check it
+                    if Func == nil || !Func.Type.Unary() { return Expr{Kind: ExprList, List: []Expr{}} }
                     ins := args[1].Eval(gs).List
                     var outs []Expr
                     for i := 0; i < len(ins); i++ {
-                        outs = append(outs, Func.Impl(gs, []Expr{ins[i]}))
+                        call := Expr{Kind: ExprFunc, Func: *Func, Args: []Expr{ins[i]}, Loc: args[0].Loc}
+                        outs = append(outs, call.Eval(gs))
                     }
                     return Expr{Kind: ExprList, List: outs}
                 },
             },
             Function{
                 Id: "head",
+                Builtin: true,
+                Doc: FuncDoc{
+                    Syntax:      "(head list)",
+                    Description: "Returns first element of list.",
+                    Examples:    []string{"(head [1.1 2.2 3.3])"},
+                },
                 Type: FuncType{
                     Types: []ExprType{{Kind: ExprList}},
                     RType: &ExprType{Kind: ExprNone}, // placeholder
@@ -358,6 +519,12 @@ func GospInit() GospState {
             },
             Function{
                 Id: "tail",
+                Builtin: true,
+                Doc: FuncDoc{
+                    Syntax:      "(tail list)",
+                    Description: "Returns list without first element.",
+                    Examples:    []string{"(tail [1.1 2.2 3.3])"},
+                },
                 Type: FuncType{
                     Types: []ExprType{{Kind: ExprList}},
                     RType: &ExprType{Kind: ExprList},
@@ -374,6 +541,12 @@ func GospInit() GospState {
             },
             Function{
                 Id: "<",
+                Builtin: true,
+                Doc: FuncDoc{
+                    Syntax:      "(< a b)",
+                    Description: "Checks if a < b.",
+                    Examples:    []string{"(< 5.5 10.2)"},
+                },
                 Type: FuncType{
                     Types: []ExprType{
                         ExprType{Kind: ExprDouble},
@@ -389,6 +562,12 @@ func GospInit() GospState {
             },
             Function{
                 Id: ">",
+                Builtin: true,
+                Doc: FuncDoc{
+                    Syntax:      "(> a b)",
+                    Description: "Checks if a > b.",
+                    Examples:    []string{"(> 5.3 10.4)"},
+                },
                 Type: FuncType{
                     Types: []ExprType{
                         ExprType{Kind: ExprDouble},
@@ -404,6 +583,12 @@ func GospInit() GospState {
             },
             Function{
                 Id: "=",
+                Builtin: true,
+                Doc: FuncDoc{
+                    Syntax:      "(= a b)",
+                    Description: "Checks equality.",
+                    Examples:    []string{"(= 5.5 5.5)"},
+                },
                 Type: FuncType{
                     Types: []ExprType{
                         ExprType{Kind: ExprDouble},
@@ -473,8 +658,9 @@ func (et ExprType) SimpType() ExprType {
     case ExprId:     fallthrough
     case ExprStr:    fallthrough
     case ExprInt:    fallthrough
-    case ExprDouble: break
-    default: log.Unreachable("unknown expr type: %s", thisType.Kind.Str())
+    case ExprDouble: fallthrough
+    case ExprBool:   break
+    // unknown kinds are kept, they are reported by Eval
     }
     return thisType
 }
@@ -489,8 +675,9 @@ func (et ExprType) SameType(other ExprType) (ok bool) {
     case ExprId:     fallthrough
     case ExprStr:    fallthrough
     case ExprInt:    fallthrough
-    case ExprDouble: break
-    default: log.Unreachable("unknown expr type: %s", et.Kind.Str())
+    case ExprDouble: fallthrough
+    case ExprBool:   break
+    default: return false
     }
     return true
 }
@@ -505,7 +692,7 @@ func (p *Parser) ParseFuncArg(gs *GospState, Func Function, EType ExprType,
     for checkExpr.Kind == ExprId {
         var exprBind *Binding
         for i := 0; i < len(gs.Bindings); i++ {
-            if gs.Bindings[i].Id == expr.Id {
+            if gs.Bindings[i].Id == checkExpr.Id {
                 exprBind = &gs.Bindings[i]
                 break
             }
@@ -527,6 +714,10 @@ restore:
     return
 }
 func (p *Parser) CheckUnique(gs *GospState, binding string) (ok bool) {
+    if reservedForm(binding) {
+        p.SetErr(fmt.Errorf("`%s` already exists: special form", binding))
+        return false
+    }
     for i := 0; i < len(gs.Funcs); i++ {
         if gs.Funcs[i].Id == binding {
             p.SetErr(fmt.Errorf("`%s` already exists: function", binding))
@@ -613,6 +804,7 @@ func (et ExprType) ZeroExpr() Expr {
     }
 }
 func (p *Parser) ParseDefun(gs *GospState) (expr Expr, ok, validObj bool) {
+    var ttype lexer.TokenType
     var body Expr
     var RType ExprType
     var capturedArgs []NamedArg
@@ -639,7 +831,6 @@ func (p *Parser) ParseDefun(gs *GospState) (expr Expr, ok, validObj bool) {
     ok = p.ParseAndExpect(lexer.TokenOParen)
     if !ok { goto restore }
     for {
-        var ttype lexer.TokenType
         var exprArg Expr
         ttype, ok = p.PeekToken()
         if !ok { goto restore }
@@ -651,6 +842,7 @@ func (p *Parser) ParseDefun(gs *GospState) (expr Expr, ok, validObj bool) {
             } else {
                 p.ExpectedErr(lexer.TokenId.Str(), exprArg.Kind.Str())
             }
+            ok = false
             goto restore
         }
         narg := NamedArg{}
@@ -667,6 +859,7 @@ func (p *Parser) ParseDefun(gs *GospState) (expr Expr, ok, validObj bool) {
             }
         }
         ok = p.ParseAndExpect(lexer.TokenId)
+        if !ok { goto restore }
         narg.Type.Kind = Str2ExprKind(p.Str)
         if narg.Type.Kind == ExprNone {
             p.SetErr(fmt.Errorf("unknown type: `%s`", p.Str))
@@ -682,9 +875,12 @@ func (p *Parser) ParseDefun(gs *GospState) (expr Expr, ok, validObj bool) {
     if !ok { goto restore }
 
     Func.Type.Types = make([]ExprType, len(nargs))
+    Func.Doc.Syntax = "(" + Func.Id
     for i := 0; i < len(nargs); i++ {
         Func.Type.Types[i] = nargs[i].Type
+        Func.Doc.Syntax += " " + nargs[i].Id
     }
+    Func.Doc.Syntax += ")"
 
     savedBindings2 = gs.Bindings
     for i := 0; i < len(nargs); i++ {
@@ -694,6 +890,19 @@ func (p *Parser) ParseDefun(gs *GospState) (expr Expr, ok, validObj bool) {
         })
     }
 
+    // optional docstring, when string is not the body itself
+    ttype, ok = p.PeekToken()
+    if ok && ttype == lexer.TokenStr {
+        docCur := p.Cursor
+        p.GetToken()
+        doc := p.Str
+        if ttype, ok = p.PeekToken(); ok && ttype != lexer.TokenCParen {
+            Func.Doc.Description = doc
+        } else {
+            p.Cursor = docCur
+        }
+    }
+
     body, ok = p.ParseExpr(gs)
     gs.Bindings = savedBindings2
     if !ok { goto restore }
@@ -738,10 +947,12 @@ func (p *Parser) ParseFunc(gs *GospState) (expr Expr, ok bool) {
     var Func    *Function
     var id       string
     var exprArg  Expr
+    var loc      lexer.Location
     savedCur := p.Cursor
     savedBindings := gs.Bindings
     ok = p.ParseAndExpect(lexer.TokenOParen)
     if !ok { goto restore }
+    loc = p.TokenLoc
     ok  = p.ParseAndExpect(lexer.TokenId)
     if !ok { goto restore }
     id = p.Str
@@ -756,7 +967,7 @@ func (p *Parser) ParseFunc(gs *GospState) (expr Expr, ok bool) {
         ok = false
         return
     }
-    expr = Expr{Kind: ExprFunc, Func: *Func}
+    expr = Expr{Kind: ExprFunc, Func: *Func, Loc: loc}
     for i := 0; i < len(expr.Func.Type.Types); i++ {
         EType := expr.Func.Type.Types[i]
         const isVType = false
@@ -801,6 +1012,16 @@ func (p *Parser) ParseFunc(gs *GospState) (expr Expr, ok bool) {
             expr.Func.Type.RType = &at // tail type <=> return type
         }
     }
+    if expr.Func.Id == "map" && len(expr.Args) == 2 {
+        for i := 0; i < len(gs.Funcs); i++ {
+            if gs.Funcs[i].Id == expr.Args[0].Id && !gs.Funcs[i].Type.Unary() {
+                p.PExpectedErr(expr.Func.Id, "function of one argument", "`" + expr.Args[0].Id + "`")
+                p.ErrLoc = expr.Args[0].Loc
+                ok = false
+                goto restore
+            }
+        }
+    }
     return
 restore:
     p.Cursor = savedCur
@@ -808,8 +1029,6 @@ restore:
     return
 }
 func (p *Parser) ParseList(gs *GospState) (expr Expr, ok bool) {
-    var savedCur2 lexer.Location
-    var savedBindings2 []Binding
     var exprArg Expr
     var exprType ExprType
     savedCur := p.Cursor
@@ -817,25 +1036,26 @@ func (p *Parser) ParseList(gs *GospState) (expr Expr, ok bool) {
     ok = p.ParseAndExpect(lexer.TokenOBracket)
     if !ok { goto restore }
     expr.Kind = ExprList
-    savedCur2 = p.Cursor
-    savedBindings2 = gs.Bindings
-    exprArg, ok = p.ParseExpr(gs)
-    if !ok {
-        ok = p.ParseAndExpect(lexer.TokenCBracket)
-        if !ok { goto restore }
-    }
-    p.Cursor = savedCur2
-    gs.Bindings = savedBindings2
-    exprType = exprArg.GetExprType()
     for {
         exprArg, ok = p.ParseExpr(gs)
         if !ok {
+            if p.Err == errTooDeep { goto restore }
             ok = p.ParseAndExpect(lexer.TokenCBracket)
             if !ok { goto restore }
             break
         }
+        // end of input, list is never closed
+        if exprArg.Kind == ExprNone {
+            p.ExpectedErr(lexer.TokenCBracket.Str(), "nothing")
+            ok = false
+            goto restore
+        }
+        // first element defines type of list, it's not parsed twice,
+        // otherwise nested lists take exponential time
+        if len(expr.List) == 0 { exprType = exprArg.GetExprType() }
         if !exprType.SameType(exprArg.GetExprType().SimpType()) {
             p.ExpectedErr(exprType.Str(), exprArg.GetExprType().Str())
+            ok = false
             goto restore
         }
         expr.List = append(expr.List, exprArg)
@@ -857,6 +1077,21 @@ func (p *Parser) ParseExpr(gs *GospState) (expr Expr, ok bool) {
         _, ok = p.GetToken()
         return
     }
+    if ttype == lexer.TokenOParen || ttype == lexer.TokenOBracket {
+        // parsing of deeply nested source takes time too
+        if gs.Interrupted() {
+            p.SetErr(gs.Err)
+            ok = false
+            goto restore
+        }
+        if p.depth >= MaxNesting {
+            p.SetErr(errTooDeep)
+            ok = false
+            goto restore
+        }
+        p.depth += 1
+        defer func() { p.depth -= 1 }()
+    }
     if ttype == lexer.TokenOParen {
         var validObj bool
         expr, ok, validObj = p.ParseLet(gs)
@@ -865,6 +1100,18 @@ func (p *Parser) ParseExpr(gs *GospState) (expr Expr, ok bool) {
         expr, ok, validObj = p.ParseDefun(gs)
         if ok { return }
         if validObj { goto restore }
+        expr, ok, validObj = p.ParseHelp(gs)
+        if ok { return }
+        if validObj { goto restore }
+        expr, ok, validObj = p.ParseProfile(gs)
+        if ok { return }
+        if validObj { goto restore }
+        expr, ok, validObj = p.ParseAssert(gs)
+        if ok { return }
+        if validObj { goto restore }
+        expr, ok, validObj = p.ParseDeftest(gs)
+        if ok { return }
+        if validObj { goto restore }
         expr, ok = p.ParseFunc(gs)
         if !ok { goto restore }
         return
@@ -0,0 +1,164 @@
+package parser
+
+import (
+    "compress/gzip"
+    "io"
+    "sort"
+    "time"
+)
+
+// minimal protobuf encoder for profile.proto of github.com/google/pprof
+type protoBuf struct {
+    data []byte
+}
+
+func (b *protoBuf) varint(x uint64) {
+    for x >= 0x80 {
+        b.data = append(b.data, byte(x) | 0x80)
+        x >>= 7
+    }
+    b.data = append(b.data, byte(x))
+}
+
+func (b *protoBuf) uint64(field int, x uint64) {
+    if x == 0 { return }
+    b.varint(uint64(field) << 3) // wire type 0
+    b.varint(x)
+}
+
+func (b *protoBuf) int64(field int, x int64) {
+    b.uint64(field, uint64(x))
+}
+
+func (b *protoBuf) bytes(field int, data []byte) {
+    b.varint(uint64(field) << 3 | 2)
+    b.varint(uint64(len(data)))
+    b.data = append(b.data, data...)
+}
+
+func (b *protoBuf) message(field int, msg func(m *protoBuf)) {
+    var m protoBuf
+    msg(&m)
+    b.bytes(field, m.data)
+}
+
+func (b *protoBuf) packed(field int, xs []uint64) {
+    var m protoBuf
+    for _, x := range xs {
+        m.varint(x)
+    }
+    b.bytes(field, m.data)
+}
+
+// profile.proto field numbers
+const (
+    pprofSampleType   = 1
+    pprofSample       = 2
+    pprofLocation     = 4
+    pprofFunction     = 5
+    pprofStringTable  = 6
+    pprofTimeNanos    = 9
+    pprofDuration     = 10
+    pprofDefaultType  = 14
+
+    pprofValueTypeType = 1
+    pprofValueTypeUnit = 2
+
+    pprofSampleLocation = 1
+    pprofSampleValue    = 2
+
+    pprofLocationId   = 1
+    pprofLocationLine = 4
+    pprofLineFunction = 1
+    pprofLineLine     = 2
+    pprofLineColumn   = 3
+
+    pprofFunctionId       = 1
+    pprofFunctionName     = 2
+    pprofFunctionFilename = 4
+)
+
+// Writes gzipped profile which can be opened by `go tool pprof`.
+// Sample values are calls, flat time and estimated allocated bytes.
+func (pr *Profiler) WritePprof(w io.Writer) error {
+    strs := []string{""}
+    strIndex := map[string]int64{"": 0}
+    str := func(s string) int64 {
+        if i, ok := strIndex[s]; ok { return i }
+        strIndex[s] = int64(len(strs))
+        strs = append(strs, s)
+        return strIndex[s]
+    }
+    type funcKey struct{ name, file string }
+    funcIds := make(map[funcKey]uint64)
+    locIds  := make(map[profileKey]uint64)
+
+    var b protoBuf
+    valueType := func(typ, unit string) func(m *protoBuf) {
+        return func(m *protoBuf) {
+            m.int64(pprofValueTypeType, str(typ))
+            m.int64(pprofValueTypeUnit, str(unit))
+        }
+    }
+    b.message(pprofSampleType, valueType("calls", "count"))
+    b.message(pprofSampleType, valueType("time", "nanoseconds"))
+    b.message(pprofSampleType, valueType("alloc_space", "bytes"))
+
+    // samples are sorted for stable output
+    ids := make([]string, 0, len(pr.samples))
+    for id := range pr.samples {
+        ids = append(ids, id)
+    }
+    sort.Strings(ids)
+    var funcs, locs protoBuf
+    for _, id := range ids {
+        sample := pr.samples[id]
+        stack := make([]uint64, len(sample.stack))
+        for i, key := range sample.stack {
+            locId, ok := locIds[key]
+            if !ok {
+                fk := funcKey{key.Func, key.Source}
+                funcId, ok := funcIds[fk]
+                if !ok {
+                    funcId = uint64(len(funcIds) + 1)
+                    funcIds[fk] = funcId
+                    funcs.message(pprofFunction, func(m *protoBuf) {
+                        m.uint64(pprofFunctionId, funcId)
+                        m.int64(pprofFunctionName, str(key.Func))
+                        m.int64(pprofFunctionFilename, str(key.Source))
+                    })
+                }
+                locId = uint64(len(locIds) + 1)
+                locIds[key] = locId
+                locs.message(pprofLocation, func(m *protoBuf) {
+                    m.uint64(pprofLocationId, locId)
+                    m.message(pprofLocationLine, func(l *protoBuf) {
+                        l.uint64(pprofLineFunction, funcId)
+                        l.int64(pprofLineLine, int64(key.Line))
+                        l.int64(pprofLineColumn, int64(key.Column))
+                    })
+                })
+            }
+            stack[i] = locId
+        }
+        b.message(pprofSample, func(m *protoBuf) {
+            m.packed(pprofSampleLocation, stack)
+            m.packed(pprofSampleValue, []uint64{
+                uint64(sample.calls), uint64(sample.nanos), uint64(sample.bytes),
+            })
+        })
+    }
+    b.data = append(b.data, locs.data...)
+    b.data = append(b.data, funcs.data...)
+
+    b.int64(pprofTimeNanos, pr.Start.UnixNano())
+    b.int64(pprofDuration, int64(time.Since(pr.Start)))
+    b.int64(pprofDefaultType, str("time"))
+    for _, s := range strs {
+        b.bytes(pprofStringTable, []byte(s))
+    }
+
+    zw := gzip.NewWriter(w)
+    if _, err := zw.Write(b.data); err != nil { return err }
+    return zw.Close()
+}
@@ -0,0 +1,163 @@
+package parser
+
+import (
+    "bytes"
+    "compress/gzip"
+    "io"
+    "testing"
+
+    "github.com/Fipaan/gosp/lexer"
+)
+
+// field of protobuf message, varint or length-delimited
+type protoField struct {
+    num  int
+    val  uint64
+    data []byte
+}
+
+func readVarint(t *testing.T, data []byte, i *int) uint64 {
+    t.Helper()
+    var x uint64
+    for shift := 0; ; shift += 7 {
+        if *i >= len(data) || shift > 63 { t.Fatalf("truncated varint") }
+        b := data[*i]
+        *i += 1
+        x |= uint64(b & 0x7f) << shift
+        if b < 0x80 { return x }
+    }
+}
+
+func decodeProto(t *testing.T, data []byte) (fields []protoField) {
+    t.Helper()
+    for i := 0; i < len(data); {
+        tag := readVarint(t, data, &i)
+        f := protoField{num: int(tag >> 3)}
+        switch tag & 7 {
+        case 0:
+            f.val = readVarint(t, data, &i)
+        case 2:
+            n := int(readVarint(t, data, &i))
+            if i + n > len(data) { t.Fatalf("field %d: truncated bytes", f.num) }
+            f.data = data[i:i+n]
+            i += n
+        default:
+            t.Fatalf("field %d: unexpected wire type %d", f.num, tag & 7)
+        }
+        fields = append(fields, f)
+    }
+    return
+}
+
+func protoUint(t *testing.T, data []byte, num int) uint64 {
+    t.Helper()
+    for _, f := range decodeProto(t, data) {
+        if f.num == num { return f.val }
+    }
+    return 0
+}
+
+func protoPacked(t *testing.T, data []byte, num int) (xs []uint64) {
+    t.Helper()
+    for _, f := range decodeProto(t, data) {
+        if f.num != num { continue }
+        for i := 0; i < len(f.data); {
+            xs = append(xs, readVarint(t, f.data, &i))
+        }
+    }
+    return
+}
+
+func TestWritePprof(t *testing.T) {
+    p := ParserInit()
+    p.AddSourceNamed("prof.gosp", "(defun sq (x double) (* x x)) (map sq [1.0 2.0 3.0])")
+    gs := GospInit()
+    pr := NewProfiler()
+    gs.Hook = pr
+    for p.SkipSpaces(true) == lexer.ReadOk {
+        expr, ok := p.ParseExpr(&gs)
+        if !ok { t.Fatalf("%s: %s", p.ErrLoc.Loc(), p.Err) }
+        expr.Eval(&gs)
+    }
+
+    var buf bytes.Buffer
+    if err := pr.WritePprof(&buf); err != nil { t.Fatal(err) }
+    zr, err := gzip.NewReader(&buf)
+    if err != nil { t.Fatal(err) }
+    data, err := io.ReadAll(zr)
+    if err != nil { t.Fatal(err) }
+
+    var strs []string
+    var sampleTypes, samples, locs, funcs [][]byte
+    var defaultType uint64
+    for _, f := range decodeProto(t, data) {
+        switch f.num {
+        case pprofSampleType:  sampleTypes = append(sampleTypes, f.data)
+        case pprofSample:      samples     = append(samples, f.data)
+        case pprofLocation:    locs        = append(locs, f.data)
+        case pprofFunction:    funcs       = append(funcs, f.data)
+        case pprofStringTable: strs        = append(strs, string(f.data))
+        case pprofDefaultType: defaultType = f.val
+        }
+    }
+    str := func(i uint64) string {
+        if i >= uint64(len(strs)) { t.Fatalf("string index %d out of table of %d", i, len(strs)) }
+        return strs[i]
+    }
+    if len(strs) == 0 || strs[0] != "" {
+        t.Fatalf("string table must start with empty string: %q", strs)
+    }
+
+    wantTypes := [][2]string{{"calls", "count"}, {"time", "nanoseconds"}, {"alloc_space", "bytes"}}
+    if len(sampleTypes) != len(wantTypes) { t.Fatalf("got %d sample types", len(sampleTypes)) }
+    for i, st := range sampleTypes {
+        typ  := str(protoUint(t, st, pprofValueTypeType))
+        unit := str(protoUint(t, st, pprofValueTypeUnit))
+        if typ != wantTypes[i][0] || unit != wantTypes[i][1] {
+            t.Errorf("sample type %d: got %s/%s, want %s/%s", i, typ, unit, wantTypes[i][0], wantTypes[i][1])
+        }
+    }
+    if str(defaultType) != "time" { t.Errorf("default sample type %q", str(defaultType)) }
+
+    funcNames := make(map[uint64]string)
+    for _, fn := range funcs {
+        id := protoUint(t, fn, pprofFunctionId)
+        if id == 0 || funcNames[id] != "" { t.Fatalf("function id %d is zero or duplicate", id) }
+        funcNames[id] = str(protoUint(t, fn, pprofFunctionName))
+        if file := str(protoUint(t, fn, pprofFunctionFilename)); file != "prof.gosp" {
+            t.Errorf("function %s: filename %q", funcNames[id], file)
+        }
+    }
+    locFuncs := make(map[uint64]string)
+    for _, loc := range locs {
+        id := protoUint(t, loc, pprofLocationId)
+        if id == 0 || locFuncs[id] != "" { t.Fatalf("location id %d is zero or duplicate", id) }
+        for _, f := range decodeProto(t, loc) {
+            if f.num != pprofLocationLine { continue }
+            name, ok := funcNames[protoUint(t, f.data, pprofLineFunction)]
+            if !ok { t.Fatalf("location %d refers to unknown function", id) }
+            if protoUint(t, f.data, pprofLineLine) != 1 { t.Errorf("location %d: line is not 1", id) }
+            locFuncs[id] = name
+        }
+    }
+
+    // sq is called by map three times, with * under it
+    calls := make(map[string]uint64)
+    for _, s := range samples {
+        stack := protoPacked(t, s, pprofSampleLocation)
+        values := protoPacked(t, s, pprofSampleValue)
+        if len(values) != len(wantTypes) { t.Fatalf("sample has %d values", len(values)) }
+        key := ""
+        for _, locId := range stack {
+            name, ok := locFuncs[locId]
+            if !ok { t.Fatalf("sample refers to unknown location %d", locId) }
+            key += name + "<"
+        }
+        calls[key] += values[0]
+    }
+    want := map[string]uint64{"map<": 1, "sq<map<": 3, "*<sq<map<": 3}
+    for key, n := range want {
+        if calls[key] != n { t.Errorf("stack %s: got %d calls, want %d", key, calls[key], n) }
+    }
+    if len(calls) != len(want) { t.Errorf("unexpected stacks %v", calls) }
+}
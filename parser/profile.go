@@ -0,0 +1,243 @@
+package parser
+
+import (
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "time"
+    "unsafe"
+
+    "github.com/Fipaan/gosp/lexer"
+)
+
+// Statistics of calls made at one call site
+type ProfileEntry struct {
+    Func       string
+    Loc        lexer.Location
+    Calls      int64
+    Flat       time.Duration // without calls made by this call
+    Cum        time.Duration // with them, recursive calls are counted once
+    AllocBytes int64         // estimated size of returned values
+}
+
+type profileKey struct {
+    Func   string
+    Source string
+    Line   int
+    Column int
+}
+
+type profileFrame struct {
+    key      profileKey
+    start    time.Time
+    children time.Duration
+}
+
+// calls with the same stack, for pprof
+type profileSample struct {
+    stack []profileKey // leaf first
+    calls int64
+    nanos int64
+    bytes int64
+}
+
+// EvalHook which aggregates time spent in functions
+type Profiler struct {
+    Start time.Time
+
+    entries map[profileKey]*ProfileEntry
+    active  map[profileKey]int
+    samples map[string]*profileSample
+    stack   []profileFrame
+}
+
+func NewProfiler() *Profiler {
+    return &Profiler{
+        Start:   time.Now(),
+        entries: make(map[profileKey]*ProfileEntry),
+        active:  make(map[profileKey]int),
+        samples: make(map[string]*profileSample),
+    }
+}
+
+// rough size of value in bytes
+func exprBytes(e Expr) int64 {
+    n := int64(unsafe.Sizeof(e)) + int64(len(e.Str)) + int64(len(e.Id))
+    for i := 0; i < len(e.List); i++ {
+        n += exprBytes(e.List[i])
+    }
+    return n
+}
+
+func (pr *Profiler) Enter(gs *GospState, call *Expr) {
+    key := profileKey{call.Func.Id, call.Loc.Source, call.Loc.Line, call.Loc.Column}
+    if pr.entries[key] == nil {
+        pr.entries[key] = &ProfileEntry{Func: call.Func.Id, Loc: call.Loc}
+    }
+    pr.active[key] += 1
+    pr.stack = append(pr.stack, profileFrame{key: key, start: time.Now()})
+}
+
+func (pr *Profiler) Call(gs *GospState, call *Expr, args []Expr) {}
+
+func (pr *Profiler) Exit(gs *GospState, call *Expr, result Expr) {
+    if len(pr.stack) == 0 { return }
+    depth := len(pr.stack)
+    frame := pr.stack[depth-1]
+    elapsed := time.Since(frame.start)
+    flat := elapsed - frame.children
+    alloc := exprBytes(result)
+
+    entry := pr.entries[frame.key]
+    entry.Calls += 1
+    entry.Flat  += flat
+    entry.AllocBytes += alloc
+    pr.active[frame.key] -= 1
+    if pr.active[frame.key] == 0 { entry.Cum += elapsed }
+
+    var id strings.Builder
+    stack := make([]profileKey, depth)
+    for i := 0; i < depth; i++ {
+        stack[i] = pr.stack[depth-1-i].key
+        fmt.Fprintf(&id, "%v|", stack[i])
+    }
+    sample := pr.samples[id.String()]
+    if sample == nil {
+        sample = &profileSample{stack: stack}
+        pr.samples[id.String()] = sample
+    }
+    sample.calls += 1
+    sample.nanos += int64(flat)
+    sample.bytes += alloc
+
+    pr.stack = pr.stack[:depth-1]
+    if depth > 1 { pr.stack[depth-2].children += elapsed }
+}
+
+// entries by call site, most expensive first
+func (pr *Profiler) Entries() []ProfileEntry {
+    entries := make([]ProfileEntry, 0, len(pr.entries))
+    for _, e := range pr.entries {
+        entries = append(entries, *e)
+    }
+    sort.Slice(entries, func(i, j int) bool {
+        if entries[i].Flat != entries[j].Flat { return entries[i].Flat > entries[j].Flat }
+        return entries[i].Loc.Loc() < entries[j].Loc.Loc()
+    })
+    return entries
+}
+
+// entries merged by function, Loc is of the first call site
+func (pr *Profiler) ByFunc() []ProfileEntry {
+    var funcs []ProfileEntry
+    index := make(map[string]int)
+    for _, e := range pr.Entries() {
+        i, ok := index[e.Func]
+        if !ok {
+            index[e.Func] = len(funcs)
+            funcs = append(funcs, e)
+            continue
+        }
+        // cum of call sites of the same function may overlap on recursion
+        funcs[i].Calls      += e.Calls
+        funcs[i].Flat       += e.Flat
+        funcs[i].Cum        += e.Cum
+        funcs[i].AllocBytes += e.AllocBytes
+    }
+    sort.SliceStable(funcs, func(i, j int) bool { return funcs[i].Flat > funcs[j].Flat })
+    return funcs
+}
+
+func durStr(d time.Duration) string {
+    switch {
+    case d >= time.Second:      return d.Round(time.Millisecond).String()
+    case d >= time.Millisecond: return d.Round(time.Microsecond).String()
+    }
+    return d.String()
+}
+
+// Flat table in the spirit of `pprof -top`, by function and by call site
+func (pr *Profiler) WriteTable(w io.Writer) {
+    var total time.Duration
+    for _, e := range pr.entries {
+        total += e.Flat
+    }
+    pct := func(d time.Duration) string {
+        if total == 0 { return "0.00%" }
+        return fmt.Sprintf("%.2f%%", float64(d) * 100 / float64(total))
+    }
+
+    fmt.Fprintf(w, "%8s %10s %7s %10s %10s  %s\n", "calls", "flat", "flat%", "cum", "alloc", "function")
+    for _, e := range pr.ByFunc() {
+        fmt.Fprintf(w, "%8d %10s %7s %10s %9dB  %s\n",
+            e.Calls, durStr(e.Flat), pct(e.Flat), durStr(e.Cum), e.AllocBytes, e.Func)
+    }
+    fmt.Fprintf(w, "\n%8s %10s %7s %10s %10s  %s\n", "calls", "flat", "flat%", "cum", "alloc", "function at location")
+    for _, e := range pr.Entries() {
+        fmt.Fprintf(w, "%8d %10s %7s %10s %9dB  %s at %s\n",
+            e.Calls, durStr(e.Flat), pct(e.Flat), durStr(e.Cum), e.AllocBytes, e.Func, e.Loc.Loc())
+    }
+    fmt.Fprintf(w, "total: %s in %d call sites\n", durStr(total), len(pr.entries))
+}
+
+// (profile expr), body is kept out of Args so that it is evaluated
+// after profiler is attached
+func (p *Parser) ParseProfile(gs *GospState) (expr Expr, ok, validObj bool) {
+    var body Expr
+    var loc lexer.Location
+    savedCur := p.Cursor
+    savedBindings := gs.Bindings
+    ok = p.ParseAndExpect(lexer.TokenOParen)
+    if !ok { goto restore }
+    loc = p.TokenLoc
+    ok = p.ParseAndExpect(lexer.TokenId)
+    if !ok { goto restore }
+    if p.Str != "profile" || gs.Shadowed(p.Str) {
+        p.ExpectedErr("profile", p.Str)
+        ok = false
+        goto restore
+    }
+    validObj = true
+
+    body, ok = p.ParseExpr(gs)
+    if !ok { goto restore }
+    if body.Kind == ExprNone {
+        p.ExpectedErr("expression", "nothing")
+        ok = false
+        goto restore
+    }
+    ok = p.ParseAndExpect(lexer.TokenCParen)
+    if !ok { goto restore }
+
+    expr = Expr{
+        Kind: ExprFunc,
+        Loc:  loc,
+        Func: Function{
+            Id:   "profile",
+            Type: FuncType{RType: &ExprType{Kind: ExprStr}},
+            Impl: func(gs *GospState, args []Expr) Expr {
+                pr := NewProfiler()
+                saved := gs.Hook
+                if saved != nil {
+                    gs.Hook = Hooks{saved, pr}
+                } else {
+                    gs.Hook = pr
+                }
+                res := body.Eval(gs)
+                gs.Hook = saved
+                if gs.Interrupted() { return Expr{Kind: ExprNone} }
+
+                var b strings.Builder
+                fmt.Fprintf(&b, "Result: %s\n", ValueStr(gs, res))
+                pr.WriteTable(&b)
+                return Expr{Kind: ExprStr, Str: b.String()}
+            },
+        },
+    }
+    return
+restore:
+    p.Cursor = savedCur
+    gs.Bindings = savedBindings
+    return
+}
@@ -0,0 +1,213 @@
+package parser
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/Fipaan/gosp/lexer"
+)
+
+// Failed assert or assert-equal, stops evaluation through gs.Err
+type AssertionError struct {
+    Loc lexer.Location
+    Msg string
+}
+
+func (e *AssertionError) Error() string {
+    return "assertion failed: " + e.Msg
+}
+
+// Test defined by deftest, run by `gosp test`
+type Test struct {
+    Name string
+    Loc  lexer.Location
+    Body []Expr
+}
+
+// structural equality of evaluated values
+func ValuesEqual(a, b Expr) bool {
+    if a.Kind != b.Kind { return false }
+    switch a.Kind {
+    case ExprId:     return a.Id == b.Id
+    case ExprStr:    return a.Str == b.Str
+    case ExprInt:    return a.Int == b.Int
+    case ExprDouble: return a.Double == b.Double
+    case ExprBool:   return a.Bool == b.Bool
+    case ExprList:
+        if len(a.List) != len(b.List) { return false }
+        for i := 0; i < len(a.List); i++ {
+            if !ValuesEqual(a.List[i], b.List[i]) { return false }
+        }
+    }
+    return true
+}
+
+// type of expression, ids are resolved through bindings
+func (gs *GospState) valueType(expr Expr) ExprType {
+    for expr.Kind == ExprId {
+        found := false
+        for i := len(gs.Bindings) - 1; i >= 0; i-- {
+            if gs.Bindings[i].Id == expr.Id {
+                expr, found = gs.Bindings[i].Val, true
+                break
+            }
+        }
+        if !found { break }
+    }
+    return expr.GetExprType().SimpType()
+}
+
+// (assert cond ["message"]) or (assert-equal expected actual ["message"])
+func (p *Parser) ParseAssert(gs *GospState) (expr Expr, ok, validObj bool) {
+    var ttype lexer.TokenType
+    var form, msg string
+    var loc, argStart lexer.Location
+    var args []Expr
+    var arg Expr
+    nargs := 1
+    savedCur := p.Cursor
+    savedBindings := gs.Bindings
+    ok = p.ParseAndExpect(lexer.TokenOParen)
+    if !ok { goto restore }
+    loc = p.TokenLoc
+    ok = p.ParseAndExpect(lexer.TokenId)
+    if !ok { goto restore }
+    if p.Str != "assert" && p.Str != "assert-equal" || gs.Shadowed(p.Str) {
+        p.ExpectedErr("assert", p.Str)
+        ok = false
+        goto restore
+    }
+    form = p.Str
+    validObj = true
+    if form == "assert-equal" { nargs = 2 }
+
+    argStart = p.Cursor
+    for len(args) < nargs {
+        arg, ok = p.ParseExpr(gs)
+        if !ok { goto restore }
+        if arg.Kind == ExprNone {
+            p.PExpectedErr(form, "expression", "nothing")
+            ok = false
+            goto restore
+        }
+        args = append(args, arg)
+    }
+    if form == "assert" {
+        if t := gs.valueType(args[0]); t.Kind != ExprBool && t.Kind != ExprNone {
+            p.PExpectedErr(form, "bool", t.Name())
+            ok = false
+            goto restore
+        }
+        msg = strings.TrimSpace(p.TokenStr(argStart, p.Cursor))
+    } else {
+        t1, t2 := gs.valueType(args[0]), gs.valueType(args[1])
+        if t1.Kind != ExprNone && t2.Kind != ExprNone && !t1.SameType(t2) {
+            p.PExpectedErr(form, t1.Name(), t2.Name())
+            ok = false
+            goto restore
+        }
+    }
+
+    ttype, ok = p.PeekToken()
+    if ok && ttype == lexer.TokenStr {
+        p.GetToken()
+        msg = p.Str
+    }
+    ok = p.ParseAndExpect(lexer.TokenCParen)
+    if !ok { goto restore }
+
+    expr = Expr{
+        Kind: ExprFunc,
+        Loc:  loc,
+        Args: args,
+        Func: Function{
+            Id:   form,
+            Type: FuncType{RType: &ExprType{Kind: ExprBool}},
+            Impl: func(gs *GospState, args []Expr) Expr {
+                fail := ""
+                if form == "assert" {
+                    if v := args[0].Eval(gs); !(v.Kind == ExprBool && v.Bool) { fail = msg }
+                } else {
+                    expected, actual := args[0].Eval(gs), args[1].Eval(gs)
+                    if !ValuesEqual(expected, actual) {
+                        fail = fmt.Sprintf("expected %s, got %s", ValueStr(gs, expected), ValueStr(gs, actual))
+                        if msg != "" { fail = msg + ": " + fail }
+                    }
+                }
+                if gs.Interrupted() { return Expr{Kind: ExprNone} }
+                if fail != "" {
+                    gs.Err = &AssertionError{Loc: loc, Msg: fail}
+                    return Expr{Kind: ExprNone}
+                }
+                return Expr{Kind: ExprBool, Bool: true}
+            },
+        },
+    }
+    return
+restore:
+    p.Cursor = savedCur
+    gs.Bindings = savedBindings
+    return
+}
+
+// (deftest name body...), registers test in gs.Tests, body is run only by tests
+func (p *Parser) ParseDeftest(gs *GospState) (expr Expr, ok, validObj bool) {
+    var ttype lexer.TokenType
+    var test Test
+    var body Expr
+    savedCur := p.Cursor
+    savedBindings := gs.Bindings
+    ok = p.ParseAndExpect(lexer.TokenOParen)
+    if !ok { goto restore }
+    test.Loc = p.TokenLoc
+    ok = p.ParseAndExpect(lexer.TokenId)
+    if !ok { goto restore }
+    if p.Str != "deftest" || gs.Shadowed(p.Str) {
+        p.ExpectedErr("deftest", p.Str)
+        ok = false
+        goto restore
+    }
+    validObj = true
+
+    ok = p.ParseAndExpect(lexer.TokenId)
+    if !ok { goto restore }
+    test.Name = p.Str
+    for i := 0; i < len(gs.Tests); i++ {
+        if gs.Tests[i].Name == test.Name {
+            p.SetErr(fmt.Errorf("`%s` already exists: test at %s", test.Name, gs.Tests[i].Loc.Loc()))
+            ok = false
+            goto restore
+        }
+    }
+
+    for {
+        ttype, ok = p.PeekToken()
+        if !ok || ttype == lexer.TokenCParen { break }
+        body, ok = p.ParseExpr(gs)
+        if !ok { goto restore }
+        test.Body = append(test.Body, body)
+    }
+    ok = p.ParseAndExpect(lexer.TokenCParen)
+    if !ok { goto restore }
+
+    gs.Tests = append(gs.Tests, test)
+    expr = Expr{Kind: ExprNone}
+    return
+restore:
+    p.Cursor = savedCur
+    gs.Bindings = savedBindings
+    return
+}
+
+// Evaluates test body, error is AssertionError or reason of interruption
+func (gs *GospState) RunTest(test *Test) error {
+    for i := 0; i < len(test.Body); i++ {
+        test.Body[i].Eval(gs)
+        if gs.Interrupted() {
+            err := gs.Err
+            gs.Err = nil
+            return err
+        }
+    }
+    return nil
+}
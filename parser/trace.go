@@ -0,0 +1,110 @@
+package parser
+
+import (
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+
+    "github.com/Fipaan/gosp/lexer"
+)
+
+// Function call recorded by Tracer
+type TraceNode struct {
+    Func   string         `json:"func"`
+    Loc    lexer.Location `json:"loc"`
+    Args   []string       `json:"args"`
+    Result string         `json:"result"`
+    Calls  []*TraceNode   `json:"calls,omitempty"` // made by arguments and function itself
+}
+
+// EvalHook which records calls as a tree
+type Tracer struct {
+    Calls     []*TraceNode // top-level calls
+    MaxNodes  int          // 0 means unlimited, later calls are not recorded
+    Nodes     int
+    Truncated bool
+
+    stack []*TraceNode // nil for calls which are not recorded
+}
+
+// readable value, strings are quoted unlike in ToStr
+func ValueStr(gs *GospState, val Expr) string {
+    switch val.Kind {
+    case ExprStr: return strconv.Quote(val.Str)
+    case ExprFunc, ExprLet: return "<" + val.Kind.Str() + ">"
+    case ExprList:
+        parts := make([]string, len(val.List))
+        for i := 0; i < len(val.List); i++ {
+            parts[i] = ValueStr(gs, val.List[i])
+        }
+        return "[" + strings.Join(parts, " ") + "]"
+    }
+    return val.ToStr(gs)
+}
+
+func (t *Tracer) Enter(gs *GospState, call *Expr) {
+    var parent *TraceNode
+    if len(t.stack) > 0 {
+        parent = t.stack[len(t.stack)-1]
+        if parent == nil {
+            t.stack = append(t.stack, nil)
+            return
+        }
+    }
+    if t.MaxNodes > 0 && t.Nodes >= t.MaxNodes {
+        t.Truncated = true
+        t.stack = append(t.stack, nil)
+        return
+    }
+    node := &TraceNode{Func: call.Func.Id, Loc: call.Loc}
+    t.Nodes += 1
+    if parent != nil {
+        parent.Calls = append(parent.Calls, node)
+    } else {
+        t.Calls = append(t.Calls, node)
+    }
+    t.stack = append(t.stack, node)
+}
+
+func (t *Tracer) Call(gs *GospState, call *Expr, args []Expr) {
+    if len(t.stack) == 0 { return }
+    node := t.stack[len(t.stack)-1]
+    if node == nil { return }
+    node.Args = make([]string, len(args))
+    for i := 0; i < len(args); i++ {
+        node.Args[i] = ValueStr(gs, args[i])
+    }
+}
+
+func (t *Tracer) Exit(gs *GospState, call *Expr, result Expr) {
+    if len(t.stack) == 0 { return }
+    node := t.stack[len(t.stack)-1]
+    t.stack = t.stack[:len(t.stack)-1]
+    if node != nil {
+        node.Result = ValueStr(gs, result)
+    }
+}
+
+// forgets recorded calls, limit is kept
+func (t *Tracer) Reset() {
+    *t = Tracer{MaxNodes: t.MaxNodes}
+}
+
+// (area 2.000000) -> 12.566360    file:1:1
+//   (* 3.141590 2.000000 2.000000) -> 12.566360    file:1:30
+func (t *Tracer) WriteTree(w io.Writer) {
+    var write func(nodes []*TraceNode, depth int)
+    write = func(nodes []*TraceNode, depth int) {
+        for _, n := range nodes {
+            call := n.Func
+            if len(n.Args) > 0 { call += " " + strings.Join(n.Args, " ") }
+            fmt.Fprintf(w, "%s(%s) -> %s    %s\n", strings.Repeat("  ", depth), call, n.Result, n.Loc.Loc())
+            write(n.Calls, depth + 1)
+        }
+    }
+    write(t.Calls, 0)
+    if t.Truncated {
+        fmt.Fprintf(w, "... trace truncated after %d calls\n", t.Nodes)
+    }
+}
@@ -0,0 +1,194 @@
+package repl
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+
+    "github.com/Fipaan/gosp/parser"
+)
+
+var ErrAborted = errors.New("aborted by debugger")
+
+// stops on call of function Func, or on call at Line of Source
+type Breakpoint struct {
+    Func   string
+    Source string // any source when empty
+    Line   int
+}
+
+// :break argument: name, line or source:line
+func ParseBreakpoint(arg string) (bp Breakpoint, err error) {
+    if arg == "" { return bp, fmt.Errorf("expected function name or line") }
+    if line, err := strconv.Atoi(arg); err == nil {
+        if line < 1 { return bp, fmt.Errorf("line must be positive") }
+        return Breakpoint{Line: line}, nil
+    }
+    if i := strings.LastIndexByte(arg, ':'); i > 0 {
+        if line, err := strconv.Atoi(arg[i+1:]); err == nil && line >= 1 {
+            return Breakpoint{Source: arg[:i], Line: line}, nil
+        }
+    }
+    return Breakpoint{Func: arg}, nil
+}
+
+func (bp Breakpoint) String() string {
+    switch {
+    case bp.Func != "":   return bp.Func
+    case bp.Source != "": return fmt.Sprintf("%s:%d", bp.Source, bp.Line)
+    }
+    return fmt.Sprintf("line %d", bp.Line)
+}
+
+func (bp Breakpoint) match(call *parser.Expr) bool {
+    if bp.Func != "" { return call.Func.Id == bp.Func }
+    return call.Loc.Line == bp.Line && (bp.Source == "" || bp.Source == call.Loc.Source)
+}
+
+type stepMode uint8
+const (
+    modeContinue stepMode = iota // only breakpoints stop
+    modeStepIn                   // next call stops
+    modeStepOver                 // next call at the same depth or above stops
+    modeStepOut                  // next call above current depth stops
+)
+
+type frame struct {
+    call *parser.Expr
+    args []parser.Expr
+}
+
+// EvalHook which stops on breakpoints and steps, commands are read from in
+type Debugger struct {
+    Breakpoints []Breakpoint
+
+    in    lineReader
+    out   io.Writer
+    mode  stepMode
+    depth int // of call where debugger stopped last time
+    stack []frame
+}
+
+type lineReader interface {
+    ReadString(delim byte) (string, error)
+}
+
+// call depth and stepping are forgotten, mode is set for next evaluation
+func (d *Debugger) reset(stepIn bool) {
+    d.stack = d.stack[:0]
+    d.mode, d.depth = modeContinue, 0
+    if stepIn { d.mode = modeStepIn }
+}
+
+// arguments which are still evaluated are shown as ...
+func callStr(gs *parser.GospState, f frame) string {
+    s := "(" + f.call.Func.Id
+    if f.args == nil && len(f.call.Args) > 0 { return s + " ...)" }
+    for _, arg := range f.args {
+        s += " " + parser.ValueStr(gs, arg)
+    }
+    return s + ")"
+}
+
+func (d *Debugger) Enter(gs *parser.GospState, call *parser.Expr) {
+    d.stack = append(d.stack, frame{call: call})
+}
+
+// stops once arguments are known
+func (d *Debugger) Call(gs *parser.GospState, call *parser.Expr, args []parser.Expr) {
+    depth := len(d.stack)
+    if depth == 0 { return }
+    d.stack[depth-1].args = args
+
+    stop, reason := false, "step"
+    switch d.mode {
+    case modeStepIn:   stop = true
+    case modeStepOver: stop = depth <= d.depth
+    case modeStepOut:  stop = depth <  d.depth
+    }
+    for i, bp := range d.Breakpoints {
+        if !stop && bp.match(call) {
+            stop, reason = true, fmt.Sprintf("breakpoint %d (%s)", i + 1, bp)
+        }
+    }
+    if !stop { return }
+
+    d.depth = depth
+    fmt.Fprintf(d.out, "-> %s    %s [%s]\n", callStr(gs, d.stack[depth-1]), call.Loc.Loc(), reason)
+    d.prompt(gs)
+}
+
+func (d *Debugger) Exit(gs *parser.GospState, call *parser.Expr, result parser.Expr) {
+    depth := len(d.stack)
+    if depth == 0 { return }
+    if d.mode != modeContinue && depth <= d.depth && !gs.Interrupted() {
+        fmt.Fprintf(d.out, "<- %s = %s\n", callStr(gs, d.stack[depth-1]), parser.ValueStr(gs, result))
+    }
+    d.stack = d.stack[:depth-1]
+}
+
+const debugHelp = `Debugger commands:
+    s, step        stop at next call
+    n, next        stop at next call which is not inside current one
+    o, out         stop after current call returns
+    c, continue    run until breakpoint
+    a, args        arguments of current call
+    b, bindings    visible bindings, innermost first
+    bt, backtrace  calls being evaluated
+    q, quit        abort evaluation
+`
+
+// reads commands until one of them resumes evaluation
+func (d *Debugger) prompt(gs *parser.GospState) {
+    for {
+        fmt.Fprint(d.out, "(debug) ")
+        line, err := d.in.ReadString('\n')
+        if err != nil && line == "" {
+            fmt.Fprintln(d.out)
+            gs.Err, d.mode = ErrAborted, modeContinue
+            return
+        }
+        switch strings.TrimSpace(line) {
+        case "s", "step":
+            d.mode = modeStepIn
+            return
+        case "n", "next", "":
+            d.mode = modeStepOver
+            return
+        case "o", "out":
+            d.mode = modeStepOut
+            return
+        case "c", "continue":
+            d.mode = modeContinue
+            return
+        case "q", "quit":
+            gs.Err, d.mode = ErrAborted, modeContinue
+            return
+        case "a", "args":
+            f := d.stack[len(d.stack)-1]
+            fmt.Fprintf(d.out, "%s\n", f.call.Func.Type.Signature(f.call.Func.Id))
+            for i, arg := range f.args {
+                fmt.Fprintf(d.out, "    %d: %s\n", i, parser.ValueStr(gs, arg))
+            }
+        case "b", "bindings":
+            if len(gs.Bindings) == 0 {
+                fmt.Fprintln(d.out, "no bindings")
+            }
+            for i := len(gs.Bindings) - 1; i >= 0; i-- {
+                b := gs.Bindings[i]
+                fmt.Fprintf(d.out, "    %s = %s\n", b.Id, parser.ValueStr(gs, b.Val))
+            }
+        case "bt", "backtrace":
+            for i := len(d.stack) - 1; i >= 0; i-- {
+                f := d.stack[i]
+                fmt.Fprintf(d.out, "    #%d %s    %s\n", len(d.stack) - 1 - i, callStr(gs, f), f.call.Loc.Loc())
+            }
+        case "h", "help":
+            fmt.Fprint(d.out, debugHelp)
+        default:
+            fmt.Fprintln(d.out, "unknown command, try `help`")
+        }
+    }
+}
@@ -0,0 +1,249 @@
+package repl
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+
+    "github.com/Fipaan/gosp/lexer"
+    "github.com/Fipaan/gosp/parser"
+)
+
+type REPL struct {
+    in  *bufio.Reader
+    out io.Writer
+    gs  parser.GospState
+
+    inputs  int // evaluated inputs, for source names
+    tracing bool
+    tracer  parser.Tracer
+    dbg     Debugger
+    stepIn  bool // debugger stops at first call of next input
+}
+
+func New(in io.Reader, out io.Writer) *REPL {
+    rp := &REPL{in: bufio.NewReader(in), out: out, gs: parser.GospInit()}
+    rp.dbg.in, rp.dbg.out = rp.in, out
+    rp.gs.Hook = rp
+    return rp
+}
+
+// tracer records calls only when tracing is on
+func (rp *REPL) Enter(gs *parser.GospState, call *parser.Expr) {
+    if rp.tracing { rp.tracer.Enter(gs, call) }
+    rp.dbg.Enter(gs, call)
+}
+
+func (rp *REPL) Call(gs *parser.GospState, call *parser.Expr, args []parser.Expr) {
+    if rp.tracing { rp.tracer.Call(gs, call, args) }
+    rp.dbg.Call(gs, call, args)
+}
+
+func (rp *REPL) Exit(gs *parser.GospState, call *parser.Expr, result parser.Expr) {
+    rp.dbg.Exit(gs, call, result)
+    if rp.tracing { rp.tracer.Exit(gs, call, result) }
+}
+
+// Evaluates files, then reads expressions and commands until EOF or :quit
+func Run(in io.Reader, out io.Writer, files []string) error {
+    rp := New(in, out)
+    for _, name := range files {
+        if err := rp.Load(name); err != nil { return err }
+    }
+    fmt.Fprintln(out, "gosp REPL, :help for commands")
+    return rp.Loop()
+}
+
+// Evaluates files without interaction, failed is set when any expression fails
+func RunFiles(out io.Writer, files []string, hook parser.EvalHook) (failed bool, err error) {
+    rp := New(strings.NewReader(""), out)
+    rp.gs.Hook = hook
+    for _, name := range files {
+        p := parser.ParserInit()
+        if err = p.AddSourceFile(name); err != nil { return }
+        if rp.eval(&p) > 0 { failed = true }
+    }
+    return
+}
+
+func (rp *REPL) Loop() error {
+    for {
+        fmt.Fprint(rp.out, "gosp> ")
+        input, err := rp.readInput()
+        if strings.TrimSpace(input) != "" {
+            if quit := rp.handle(input); quit { return nil }
+        }
+        if errors.Is(err, io.EOF) {
+            fmt.Fprintln(rp.out)
+            return nil
+        }
+        if err != nil { return err }
+    }
+}
+
+// reads lines until brackets are balanced
+func (rp *REPL) readInput() (string, error) {
+    var b strings.Builder
+    depth := 0
+    for {
+        line, err := rp.in.ReadString('\n')
+        b.WriteString(line)
+        depth += bracketDepth(line)
+        if err != nil { return b.String(), err }
+        if depth <= 0 || strings.HasPrefix(strings.TrimSpace(b.String()), ":") {
+            return b.String(), nil
+        }
+        fmt.Fprint(rp.out, "  ... ")
+    }
+}
+
+// change of bracket depth, strings and comments are skipped
+func bracketDepth(line string) (depth int) {
+    inStr, escaping := false, false
+    for _, ch := range line {
+        switch {
+        case escaping:          escaping = false
+        case inStr && ch == '\\': escaping = true
+        case ch == '"':         inStr = !inStr
+        case inStr:
+        case ch == ';':         return
+        case ch == '(' || ch == '[': depth += 1
+        case ch == ')' || ch == ']': depth -= 1
+        }
+    }
+    return
+}
+
+const replHelp = `Commands:
+    :help                   show this message
+    :load FILE              evaluate file
+    :trace on|off           print calls of each evaluation as a tree
+    :break NAME|[FILE:]LINE stop when function is called or at line
+    :breaks                 list breakpoints
+    :delete [N]             delete breakpoint N or all of them
+    :step                   stop at the first call of next input
+    :quit                   exit
+Other input is evaluated, (help) lists functions.
+`
+
+// returns true on :quit
+func (rp *REPL) handle(input string) bool {
+    input = strings.TrimSpace(input)
+    if !strings.HasPrefix(input, ":") {
+        rp.inputs += 1
+        rp.Eval(fmt.Sprintf("repl-%d", rp.inputs), input)
+        return false
+    }
+    cmd, arg, _ := strings.Cut(input[1:], " ")
+    arg = strings.TrimSpace(arg)
+    switch cmd {
+    case "q", "quit", "exit":
+        return true
+    case "h", "help":
+        fmt.Fprint(rp.out, replHelp)
+    case "load":
+        if err := rp.Load(arg); err != nil {
+            fmt.Fprintf(rp.out, "error: %s\n", err.Error())
+        }
+    case "trace":
+        switch arg {
+        case "on":  rp.tracing = true
+        case "off": rp.tracing = false
+        default:    fmt.Fprintln(rp.out, "usage: :trace on|off")
+        }
+    case "break", "b":
+        bp, err := ParseBreakpoint(arg)
+        if err != nil {
+            fmt.Fprintf(rp.out, "error: %s\n", err.Error())
+            break
+        }
+        rp.dbg.Breakpoints = append(rp.dbg.Breakpoints, bp)
+        fmt.Fprintf(rp.out, "breakpoint %d: %s\n", len(rp.dbg.Breakpoints), bp)
+    case "breaks":
+        if len(rp.dbg.Breakpoints) == 0 { fmt.Fprintln(rp.out, "no breakpoints") }
+        for i, bp := range rp.dbg.Breakpoints {
+            fmt.Fprintf(rp.out, "    %d: %s\n", i + 1, bp)
+        }
+    case "delete", "d":
+        if arg == "" {
+            rp.dbg.Breakpoints = nil
+            break
+        }
+        n, err := strconv.Atoi(arg)
+        if err != nil || n < 1 || n > len(rp.dbg.Breakpoints) {
+            fmt.Fprintf(rp.out, "error: no breakpoint `%s`\n", arg)
+            break
+        }
+        rp.dbg.Breakpoints = append(rp.dbg.Breakpoints[:n-1], rp.dbg.Breakpoints[n:]...)
+    case "step", "s":
+        rp.stepIn = true
+    default:
+        fmt.Fprintf(rp.out, "unknown command `:%s`, try :help\n", cmd)
+    }
+    return false
+}
+
+func (rp *REPL) Load(name string) error {
+    p := parser.ParserInit()
+    if err := p.AddSourceFile(name); err != nil { return err }
+    rp.eval(&p)
+    return nil
+}
+
+func (rp *REPL) Eval(source, text string) {
+    p := parser.ParserInit()
+    p.AddSourceNamed(source, text)
+    rp.eval(&p)
+}
+
+// evaluates expressions one by one, printing results and errors
+func (rp *REPL) eval(p *parser.Parser) (errs int) {
+    rp.dbg.reset(rp.stepIn)
+    rp.stepIn = false
+    for {
+        if p.SkipSpaces(true) != lexer.ReadOk { break }
+        start := p.Cursor
+        expr, ok := p.ParseExpr(&rp.gs)
+        if !ok || p.Cursor.Raw <= start.Raw && p.Cursor.SourceIndex == start.SourceIndex {
+            msg := "syntax error"
+            if p.Err != nil { msg = p.Err.Error() }
+            fmt.Fprintf(rp.out, "%s: %s\n", p.ErrLoc.Loc(), msg)
+            errs += 1
+            if !p.SkipExpr() { break }
+            continue
+        }
+
+        rp.tracer.Reset()
+        res := expr.ToStr(&rp.gs)
+        if rp.tracing && len(rp.tracer.Calls) > 0 {
+            rp.tracer.WriteTree(rp.out)
+        }
+        var aerr *parser.AssertionError
+        if errors.As(rp.gs.Err, &aerr) {
+            fmt.Fprintf(rp.out, "%s: %s\n", aerr.Loc.Loc(), aerr.Error())
+            rp.gs.Err = nil
+            errs += 1
+            continue
+        }
+        var derr *parser.DepthError
+        if errors.As(rp.gs.Err, &derr) {
+            fmt.Fprintf(rp.out, "%s: %s\n", derr.Loc.Loc(), derr.Error())
+            rp.gs.Err = nil
+            errs += 1
+            continue
+        }
+        if rp.gs.Err != nil {
+            fmt.Fprintf(rp.out, "%s: evaluation stopped: %s\n", start.Loc(), rp.gs.Err.Error())
+            rp.gs.Err = nil
+            rp.dbg.reset(false)
+            errs += 1
+            break
+        }
+        if expr.Kind == parser.ExprNone { continue } // defun
+        fmt.Fprintln(rp.out, res)
+    }
+    return
+}
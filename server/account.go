@@ -0,0 +1,191 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SessionInfo struct {
+    ID         string    `json:"id"`
+    CreatedAt  time.Time `json:"createdAt"`
+    LastUsedAt time.Time `json:"lastUsedAt"`
+    ExpiresAt  time.Time `json:"expiresAt"`
+    Current    bool      `json:"current"`
+}
+
+// verifies password of the session owner, writes error on failure
+func (sv *Server) checkPassword(w http.ResponseWriter, r *http.Request,
+                                username, password string) bool {
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	ok, err := sv.verifyPassword(ctx, username, password)
+	var locked *LockedError
+	if errors.As(err, &locked) {
+		WriteTooManyRequests(w, time.Until(locked.Until), "account is temporarily locked")
+		return false
+	}
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return false
+	}
+	if !ok {
+		WriteAPIError(w, http.StatusForbidden, nil, "invalid password")
+		return false
+	}
+	return true
+}
+
+func (sv *Server) HandleAccountPassword(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	if r.Method != http.MethodPost {
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		OldPassword string `json:"oldPassword"`
+		NewPassword string `json:"newPassword"`
+	}
+	if !ReadJSONBody(w, r, &req) {
+		return
+	}
+	if req.OldPassword == "" || req.NewPassword == "" {
+		WriteAPIError(w, http.StatusBadRequest, nil, "oldPassword and newPassword are required")
+		return
+	}
+
+	if !sv.checkPassword(w, r, sess.Username, req.OldPassword) {
+		return
+	}
+
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	if err := sv.DB.SetPassword(ctx, sess.Username, req.NewPassword); err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+
+	sv.audit(r, AuditPasswordChange, sess.Username, "")
+	// API tokens could be issued by whoever knew old password
+	authKeys, err := sv.DB.DeleteSessions(ctx, sess.Username, sess.AuthKey)
+	sv.dropInterpSession(authKeys...)
+	var tokenKeys []string
+	if err == nil {
+		tokenKeys, err = sv.DB.DeleteTokens(ctx, sess.Username)
+		sv.dropInterpSession(tokenKeys...)
+	}
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"status":        "OK",
+		"revoked":       len(authKeys),
+		"revokedTokens": len(tokenKeys),
+	})
+}
+
+func (sv *Server) HandleAccount(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	if r.Method != http.MethodDelete {
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if !ReadJSONBody(w, r, &req) {
+		return
+	}
+	if req.Password == "" {
+		WriteAPIError(w, http.StatusBadRequest, nil, "password is required")
+		return
+	}
+
+	if !sv.checkPassword(w, r, sess.Username, req.Password) {
+		return
+	}
+
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	authKeys, err := sv.DB.DeleteUser(ctx, sess.Username)
+	sv.dropInterpSession(authKeys...)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+	sv.audit(r, AuditAccountDelete, sess.Username, "")
+
+	sv.ClearAuthCookie(w, r)
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "OK"})
+}
+
+func (sv *Server) HandleSessions(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	if r.Method != http.MethodGet {
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+		return
+	}
+
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	docs, err := sv.DB.ListSessions(ctx, sess.Username)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+
+	items := make([]SessionInfo, 0, len(docs))
+	for _, d := range docs {
+		items = append(items, SessionInfo{
+			ID:         d.ID.Hex(),
+			CreatedAt:  d.CreatedAt,
+			LastUsedAt: d.LastUsedAt,
+			ExpiresAt:  d.ExpiresAt,
+			Current:    d.AuthKey == sess.AuthKey,
+		})
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"items": items,
+	})
+}
+
+func (sv *Server) HandleSessionRevoke(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	if r.Method != http.MethodDelete {
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		WriteAPIError(w, http.StatusBadRequest, nil, "invalid session id")
+		return
+	}
+
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	revoked, ok, err := sv.DB.DeleteSessionByID(ctx, sess.Username, id)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+	if !ok {
+		WriteAPIError(w, http.StatusNotFound, nil, "session not found")
+		return
+	}
+	sv.dropInterpSession(revoked.AuthKey)
+	sv.audit(r, AuditSessionRevoke, sess.Username, "", "sessionId", id.Hex())
+
+	if revoked.AuthKey == sess.AuthKey {
+		sv.ClearAuthCookie(w, r)
+	}
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "OK"})
+}
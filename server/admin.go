@@ -0,0 +1,271 @@
+package server
+
+import (
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type UserInfo struct {
+    Username    string     `json:"username"`
+    Role        string     `json:"role"`
+    Disabled    bool       `json:"disabled"`
+    CreatedAt   time.Time  `json:"createdAt"`
+    LockedUntil *time.Time `json:"lockedUntil,omitempty"`
+}
+
+type InterpInfo struct {
+    Username   string    `json:"username"`
+    CreatedAt  time.Time `json:"createdAt"`
+    LastUsedAt time.Time `json:"lastUsedAt"`
+    Funcs      int       `json:"funcs"`
+    Busy       bool      `json:"busy"`
+}
+
+func (sv *Server) RequireAdmin(next func(w http.ResponseWriter, r *http.Request, sess SessionDoc)) http.HandlerFunc {
+	return sv.RequireAuth(func(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+		ctx, cancel := sv.WithTimeout(r)
+		defer cancel()
+
+		u, ok, err := sv.DB.GetUser(ctx, sess.Username)
+		if err != nil {
+			WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+			return
+		}
+		if !ok || u.Disabled || u.GetRole() != RoleAdmin {
+			WriteAPIError(w, http.StatusForbidden, nil, "admin role is required")
+			return
+		}
+		next(w, r, sess)
+	})
+}
+
+func queryInt(r *http.Request, name string, def, max int64) int64 {
+	v, err := strconv.ParseInt(r.URL.Query().Get(name), 10, 64)
+	if err != nil || v < 0 { return def }
+	return min(v, max)
+}
+
+func (sv *Server) HandleAdminUsers(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	if r.Method != http.MethodGet {
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+		return
+	}
+
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	skip  := queryInt(r, "skip", 0, 1 << 31)
+	limit := queryInt(r, "limit", 100, 1000)
+	docs, err := sv.DB.ListUsers(ctx, skip, limit)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+
+	now   := time.Now()
+	items := make([]UserInfo, 0, len(docs))
+	for i := range docs {
+		u := &docs[i]
+		info := UserInfo{
+			Username:  u.Username,
+			Role:      u.GetRole(),
+			Disabled:  u.Disabled,
+			CreatedAt: u.CreatedAt,
+		}
+		if u.LockedUntil.After(now) { info.LockedUntil = &u.LockedUntil }
+		items = append(items, info)
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"items": items,
+	})
+}
+
+// drops sessions, tokens and interpreter state of username
+func (sv *Server) logoutUser(r *http.Request, username string, withTokens bool) (revoked int, err error) {
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	authKeys, err := sv.DB.DeleteSessions(ctx, username, "")
+	sv.dropInterpSession(authKeys...)
+	revoked = len(authKeys)
+	if err != nil || !withTokens { return }
+
+	authKeys, err = sv.DB.DeleteTokens(ctx, username)
+	sv.dropInterpSession(authKeys...)
+	revoked += len(authKeys)
+	return
+}
+
+func (sv *Server) HandleAdminDisable(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	if r.Method != http.MethodPost {
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Disabled bool `json:"disabled"`
+	}
+	if !ReadJSONBody(w, r, &req) {
+		return
+	}
+
+	username := r.PathValue("username")
+	if username == sess.Username {
+		WriteAPIError(w, http.StatusBadRequest, nil, "can't disable yourself")
+		return
+	}
+
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	ok, err := sv.DB.SetUserDisabled(ctx, username, req.Disabled)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+	if !ok {
+		WriteAPIError(w, http.StatusNotFound, nil, "user not found")
+		return
+	}
+	sv.audit(r, AuditAdminDisable, sess.Username, username,
+		"disabled", strconv.FormatBool(req.Disabled))
+	if req.Disabled {
+		if _, err = sv.logoutUser(r, username, true); err != nil {
+			WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+			return
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "OK"})
+}
+
+func (sv *Server) HandleAdminRole(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	if r.Method != http.MethodPost {
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if !ReadJSONBody(w, r, &req) {
+		return
+	}
+	if req.Role != RoleUser && req.Role != RoleAdmin {
+		WriteAPIError(w, http.StatusBadRequest, nil, "unknown role: %s", req.Role)
+		return
+	}
+
+	username := r.PathValue("username")
+	if username == sess.Username && req.Role != RoleAdmin {
+		WriteAPIError(w, http.StatusBadRequest, nil, "can't demote yourself")
+		return
+	}
+
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	ok, err := sv.DB.SetUserRole(ctx, username, req.Role)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+	if !ok {
+		WriteAPIError(w, http.StatusNotFound, nil, "user not found")
+		return
+	}
+	sv.audit(r, AuditAdminRole, sess.Username, username, "role", req.Role)
+
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "OK"})
+}
+
+func (sv *Server) HandleAdminLogout(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	if r.Method != http.MethodDelete {
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+		return
+	}
+
+	username := r.PathValue("username")
+	revoked, err := sv.logoutUser(r, username, false)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+	sv.audit(r, AuditAdminLogout, sess.Username, username, "revoked", strconv.Itoa(revoked))
+
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"status":  "OK",
+		"revoked": revoked,
+	})
+}
+
+func (sv *Server) interpInfos() []InterpInfo {
+	sv.stateMu.Lock()
+	defer sv.stateMu.Unlock()
+
+	items := make([]InterpInfo, 0, len(sv.States))
+	for _, s := range sv.States {
+		info := InterpInfo{
+			Username:   s.Username,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+		}
+		// busy sessions are evaluating right now, don't wait for them
+		if s.mu.TryLock() {
+			info.Funcs = len(s.gs.Funcs)
+			s.mu.Unlock()
+		} else {
+			info.Busy = true
+		}
+		items = append(items, info)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].LastUsedAt.After(items[j].LastUsedAt)
+	})
+	return items
+}
+
+func (sv *Server) HandleAdminStats(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	if r.Method != http.MethodGet {
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+		return
+	}
+
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	st, err := sv.DB.Stats(ctx)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	sv.stateMu.Lock()
+	interps := len(sv.States)
+	sv.stateMu.Unlock()
+
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"storage":    st,
+		"interps":    interps,
+		"uptime":     time.Since(sv.StartedAt).Round(time.Second).String(),
+		"goroutines": runtime.NumGoroutine(),
+		"heapBytes":  mem.HeapAlloc,
+	})
+}
+
+func (sv *Server) HandleAdminInterps(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	if r.Method != http.MethodGet {
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"items": sv.interpInfos(),
+	})
+}
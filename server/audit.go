@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// kinds of audit events
+const (
+	AuditRegister       = "register"
+	AuditLogin          = "login"
+	AuditLoginFailed    = "login-failed" // details.reason: invalid, locked or disabled
+	AuditLogout         = "logout"
+	AuditPasswordChange = "password-change"
+	AuditTokenCreate    = "token-create"
+	AuditTokenRevoke    = "token-revoke"
+	AuditSessionRevoke  = "session-revoke"
+	AuditAccountDelete  = "account-delete"
+	AuditAdminDisable   = "admin-disable"
+	AuditAdminRole      = "admin-role"
+	AuditAdminLogout    = "admin-logout"
+)
+
+var AuditEvents = []string{
+	AuditRegister, AuditLogin, AuditLoginFailed, AuditLogout, AuditPasswordChange,
+	AuditTokenCreate, AuditTokenRevoke, AuditSessionRevoke, AuditAccountDelete,
+	AuditAdminDisable, AuditAdminRole, AuditAdminLogout,
+}
+
+const maxUserAgent = 256
+
+type AuditInfo struct {
+	ID              string            `json:"id"`
+	At              time.Time         `json:"at"`
+	Event           string            `json:"event"`
+	Username        string            `json:"username,omitempty"`
+	Target          string            `json:"target,omitempty"`
+	Details         map[string]string `json:"details,omitempty"`
+	IP              string            `json:"ip,omitempty"`
+	UserAgent       string            `json:"userAgent,omitempty"`
+	RequestID       string            `json:"requestId,omitempty"`
+	ClientRequestID string            `json:"clientRequestId,omitempty"`
+}
+
+// Records event of request, failure is logged and doesn't fail the request.
+// details are key/value pairs.
+func (sv *Server) audit(r *http.Request, event, username, target string, details ...string) {
+	doc := AuditDoc{
+		Event:           event,
+		Username:        username,
+		Target:          target,
+		IP:              sv.ClientIP(r),
+		UserAgent:       r.UserAgent(),
+		RequestID:       RequestID(r),
+		ClientRequestID: ClientRequestID(r),
+	}
+	if len(doc.UserAgent) > maxUserAgent { doc.UserAgent = doc.UserAgent[:maxUserAgent] }
+	if len(details) > 0 {
+		doc.Details = make(map[string]string)
+		for i := 0; i + 1 < len(details); i += 2 {
+			doc.Details[details[i]] = details[i+1]
+		}
+	}
+
+	// request context may be canceled already, e.g. client went away
+	ctx, cancel := sv.WithTimeout(r.WithContext(context.WithoutCancel(r.Context())))
+	defer cancel()
+	if err := sv.DB.AppendAudit(ctx, doc, sv.AuditRetention); err != nil {
+		storageLog.Error("couldn't record audit event",
+			"event",     event,
+			"username",  username,
+			"requestId", doc.RequestID,
+			"error",     err)
+	}
+}
+
+// query parameter in RFC 3339, zero when missing
+func queryTime(r *http.Request, name string) (t time.Time, ok bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" { return t, true }
+	t, err := time.Parse(time.RFC3339, v)
+	return t, err == nil
+}
+
+// GET /api/admin/audit?username=&event=&ip=&since=&until=&skip=&limit=
+func (sv *Server) HandleAdminAudit(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	if r.Method != http.MethodGet {
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+	f := AuditFilter{
+		Username: q.Get("username"),
+		Event:    q.Get("event"),
+		IP:       q.Get("ip"),
+	}
+	if f.Event != "" && !slices.Contains(AuditEvents, f.Event) {
+		WriteAPIError(w, http.StatusBadRequest, nil, "unknown event: %s", f.Event)
+		return
+	}
+	var ok bool
+	if f.Since, ok = queryTime(r, "since"); !ok {
+		WriteAPIError(w, http.StatusBadRequest, nil, "since: expected RFC 3339 time")
+		return
+	}
+	if f.Until, ok = queryTime(r, "until"); !ok {
+		WriteAPIError(w, http.StatusBadRequest, nil, "until: expected RFC 3339 time")
+		return
+	}
+
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	skip  := queryInt(r, "skip", 0, 1 << 31)
+	limit := queryInt(r, "limit", 100, 1000)
+	docs, err := sv.DB.ListAudit(ctx, f, skip, limit)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+
+	items := make([]AuditInfo, 0, len(docs))
+	for _, d := range docs {
+		items = append(items, AuditInfo{
+			ID:              d.ID.Hex(),
+			At:              d.At,
+			Event:           d.Event,
+			Username:        d.Username,
+			Target:          d.Target,
+			Details:         d.Details,
+			IP:              d.IP,
+			UserAgent:       d.UserAgent,
+			RequestID:       d.RequestID,
+			ClientRequestID: d.ClientRequestID,
+		})
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"items": items,
+	})
+}
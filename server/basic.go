@@ -2,18 +2,45 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
     "github.com/Fipaan/gosp/lexer"
+    "github.com/Fipaan/gosp/log"
+    "github.com/Fipaan/gosp/parser"
 )
 
-const maxBodyBytes = 1 << 20 // 1MB
+var MaxBodyBytes int64 = 1 << 20 // 1MB
+
+// loggers of server components, records have `component` attribute
+var (
+    serverLog  = log.Component("server")
+    storageLog = log.Component("storage")
+    evalLog    = log.Component("eval")
+)
+var MaxTraceNodes = 10000     // calls recorded for traced /api/expr
+
+// time.Duration which is written as "1h30m" in JSON
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil { return err }
+	*d = Duration(v)
+	return nil
+}
 
 type APIError struct {
-	Loc     *lexer.Location `json:"loc,omitempty"`
-	Message  string    `json:"message"`
+	Loc       *lexer.Location `json:"loc,omitempty"`
+	Message    string    `json:"message"`
+	RequestID  string    `json:"requestId,omitempty"` // to be reported by users
 }
 
 func WriteJSON(w http.ResponseWriter, status int, v any) {
@@ -25,8 +52,9 @@ func WriteJSON(w http.ResponseWriter, status int, v any) {
 func WriteAPIError(w http.ResponseWriter, status int, loc *lexer.Location,
                    msg_fmt string, msg_args ...any) {
     WriteJSON(w, status, APIError{
-		Loc:     loc,
-		Message: fmt.Sprintf(msg_fmt, msg_args...),
+		Loc:       loc,
+		Message:   fmt.Sprintf(msg_fmt, msg_args...),
+		RequestID: w.Header().Get(RequestIDHeader),
 	})
 }
 
@@ -38,7 +66,7 @@ func ReadJSONBody(w http.ResponseWriter, r *http.Request, cont any) bool {
 		return false
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
 	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields()
 
@@ -54,3 +82,25 @@ func ReadJSONBody(w http.ResponseWriter, r *http.Request, cont any) bool {
 	}
 	return true
 }
+
+// unknown /api/ paths get JSON error instead of page of static files
+func HandleAPINotFound(w http.ResponseWriter, r *http.Request) {
+	WriteAPIError(w, http.StatusNotFound, nil, "not found: %s", r.URL.Path)
+}
+
+// evaluation was stopped by timeout, client disconnect or shutdown,
+// parser.InternalError is a bug of interpreter and is logged with request id
+func WriteEvalInterrupted(w http.ResponseWriter, loc *lexer.Location, transcript string, err error) {
+	var ierr *parser.InternalError
+	if errors.As(err, &ierr) {
+		evalLog.Error("internal evaluation error",
+			"requestId", w.Header().Get(RequestIDHeader),
+			"error",     ierr.Error())
+		WriteAPIError(w, http.StatusInternalServerError, loc, "%s", transcript)
+		return
+	}
+	evalLog.Warn("evaluation interrupted",
+		"requestId", w.Header().Get(RequestIDHeader),
+		"error",     err)
+	WriteAPIError(w, http.StatusServiceUnavailable, loc, "%s", transcript)
+}
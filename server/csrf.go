@@ -0,0 +1,89 @@
+package server
+
+import (
+	"crypto/hmac"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Cookie-authenticated requests which change state must echo value of
+// CSRF cookie in CSRF header (double-submit). The value is derived from
+// authKey, so it can't be planted by another site. Requests authenticated
+// by Authorization or X-Auth-Key header are exempt: browsers don't attach
+// those to cross-site requests.
+// Allowed origins can't read the cookie of API host, so the token is also
+// sent in CSRF header of login and of cookie-authenticated responses,
+// which only the server itself and allowed origins can read.
+const (
+    CSRFCookieName = "csrf_token"
+    CSRFHeader     = "X-CSRF-Token"
+)
+
+func safeMethod(method string) bool {
+    switch method {
+    case http.MethodGet, http.MethodHead, http.MethodOptions:
+        return true
+    }
+    return false
+}
+
+func (sv *Server) setCSRFCookie(w http.ResponseWriter, r *http.Request,
+                                authKey string, exp time.Time) {
+    http.SetCookie(w, &http.Cookie{
+        Name:     CSRFCookieName,
+        Value:    sv.DB.CSRFToken(authKey),
+        Path:     "/",
+        HttpOnly: false, // read by pages
+        SameSite: http.SameSiteStrictMode,
+        Expires:  exp,
+        Secure:   sv.IsSecure(r),
+    })
+    w.Header().Set(CSRFHeader, sv.DB.CSRFToken(authKey))
+}
+
+// Origin or Referer, when sent, must be the server itself or allowed origin
+func (sv *Server) checkOrigin(r *http.Request) error {
+    origin := r.Header.Get("Origin")
+    if origin == "" {
+        origin = r.Header.Get("Referer")
+    }
+    if origin == "" { return nil }
+    if origin == "null" { return errors.New("opaque origin") }
+
+    u, err := url.Parse(origin)
+    if err != nil { return errors.New("invalid origin") }
+    if ok, credentials := sv.originAllowed(u.Scheme + "://" + u.Host); ok && credentials {
+        return nil
+    }
+    if u.Host != r.Host {
+        return errors.New("cross-origin request")
+    }
+    return nil
+}
+
+func (sv *Server) checkCSRF(r *http.Request) error {
+    if safeMethod(r.Method) { return nil }
+    authKey, fromCookie := sv.extractAuthKey(r)
+    if !fromCookie { return nil }
+
+    if err := sv.checkOrigin(r); err != nil { return err }
+    token := r.Header.Get(CSRFHeader)
+    if token == "" {
+        return errors.New("missing " + CSRFHeader + " header")
+    }
+    if !hmac.Equal([]byte(token), []byte(sv.DB.CSRFToken(authKey))) {
+        return errors.New("invalid CSRF token")
+    }
+    return nil
+}
+
+// writes 403 response when CSRF check fails
+func (sv *Server) verifyCSRF(w http.ResponseWriter, r *http.Request) bool {
+    if err := sv.checkCSRF(r); err != nil {
+        WriteAPIError(w, http.StatusForbidden, nil, "CSRF check failed: %s", err.Error())
+        return false
+    }
+    return true
+}
@@ -1,7 +1,10 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"strings"
+	"time"
 
 	"github.com/Fipaan/gosp/lexer"
 	"github.com/Fipaan/gosp/parser"
@@ -10,11 +13,17 @@ import (
 // parses/evals multiple expressions from all sources
 // returns a transcript string
 // firstErrLoc nil on full success
-func EvalTS(p *parser.Parser, gs *parser.GospState) (out string, firstErrLoc *lexer.Location) {
+// err is set when evaluation was interrupted (see GospState.Ctx)
+// or stopped by parser.InternalError,
+// failed assertions and parser.DepthError are reported in transcript
+func EvalTS(p *parser.Parser, gs *parser.GospState) (out string, firstErrLoc *lexer.Location, err error) {
 	var b strings.Builder
 
 	var haveFirstErr bool
 
+	metricEvals.Inc()
+	defer metricEvalDuration.ObserveSince(time.Now())
+
     sourceIndex := p.Cursor.SourceIndex
 	fullText := string(p.Sources[sourceIndex].Chars)
 	lines := strings.Split(fullText, "\n")
@@ -38,12 +47,73 @@ func EvalTS(p *parser.Parser, gs *parser.GospState) (out string, firstErrLoc *le
 			b.WriteString("`")
 			b.WriteString(frag)
 			b.WriteString("` ->\n")
+			res := expr.ToStr(gs)
+			if gs.Err != nil {
+				err, gs.Err = gs.Err, nil
+				// failed assertion and too deep recursion are ordinary errors of expression
+				var aerr *parser.AssertionError
+				var derr *parser.DepthError
+				var loc lexer.Location
+				switch {
+				case errors.As(err, &aerr):
+					metricEvalErrors.Inc("assert")
+					loc = aerr.Loc
+				case errors.As(err, &derr):
+					metricEvalErrors.Inc("depth")
+					loc = derr.Loc
+				}
+				if aerr != nil || derr != nil {
+					if !haveFirstErr {
+						firstErrLoc = &loc
+						haveFirstErr = true
+					}
+					b.WriteString(loc.Loc())
+					b.WriteString(": ")
+					b.WriteString(err.Error())
+					b.WriteString("\n")
+					err = nil
+					continue
+				}
+				if !haveFirstErr {
+					firstErrLoc = &locStart
+				}
+				writeInterrupted(&b, locStart, err)
+				break
+			}
 			b.WriteString("Result: ")
-			b.WriteString(expr.ToStr(gs))
+			b.WriteString(res)
 			b.WriteString("\n")
 			continue
 		}
 
+		// deadline passed while parsing
+		if gs.Err != nil {
+			err, gs.Err = gs.Err, nil
+			if !haveFirstErr {
+				loc := p.ErrLoc
+				firstErrLoc = &loc
+			}
+			writeInterrupted(&b, p.ErrLoc, err)
+			break
+		}
+
+		// bug of parser, source is not to blame
+		var ierr *parser.InternalError
+		if errors.As(p.Err, &ierr) {
+			metricEvalErrors.Inc("internal")
+			if !haveFirstErr {
+				loc := p.ErrLoc
+				firstErrLoc = &loc
+			}
+			err = ierr
+			b.WriteString(p.ErrLoc.Loc())
+			b.WriteString(": ")
+			b.WriteString(ierr.Error())
+			b.WriteString("\n")
+			break
+		}
+
+		metricEvalErrors.Inc("parse")
 		if !haveFirstErr {
 			loc := p.ErrLoc
 			firstErrLoc = &loc
@@ -82,5 +152,21 @@ func EvalTS(p *parser.Parser, gs *parser.GospState) (out string, firstErrLoc *le
 		b.WriteString("\n")
 	}
 
-	return b.String(), firstErrLoc
+	return b.String(), firstErrLoc, err
+}
+
+func writeInterrupted(b *strings.Builder, loc lexer.Location, err error) {
+	var ierr *parser.InternalError
+	switch {
+	case errors.As(err, &ierr):
+		metricEvalErrors.Inc("internal")
+	case errors.Is(err, context.DeadlineExceeded):
+		metricEvalErrors.Inc("timeout")
+	default:
+		metricEvalErrors.Inc("canceled")
+	}
+	b.WriteString(loc.Loc())
+	b.WriteString(": evaluation interrupted: ")
+	b.WriteString(err.Error())
+	b.WriteString("\n")
 }
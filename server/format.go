@@ -0,0 +1,40 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Fipaan/gosp/format"
+)
+
+// POST /api/format {"code": "...", "width": 80} -> {"code": "..."}
+func (sv *Server) HandleFormat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Code  string `json:"code"`
+		Width int    `json:"width"`
+	}
+	if !ReadJSONBody(w, r, &req) {
+		return
+	}
+    if req.Width < 0 || req.Width > 1000 {
+        WriteAPIError(w, http.StatusBadRequest, nil, "width must be between 0 and 1000")
+        return
+    }
+
+    res, err := format.Source("post-request", req.Code, format.Options{Width: req.Width})
+    if err != nil {
+        var ferr *format.Error
+        if errors.As(err, &ferr) {
+            WriteAPIError(w, http.StatusBadRequest, &ferr.Loc, "%s", ferr.Msg)
+        } else {
+            WriteAPIError(w, http.StatusBadRequest, nil, "%s", err.Error())
+        }
+        return
+    }
+	WriteJSON(w, http.StatusOK, map[string]string{"code": res})
+}
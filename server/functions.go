@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/Fipaan/gosp/parser"
+)
+
+type FunctionInfo struct {
+    Name        string   `json:"name"`
+    Signature   string   `json:"signature,omitempty"`
+    Syntax      string   `json:"syntax"`
+    Description string   `json:"description,omitempty"`
+    Examples    []string `json:"examples,omitempty"`
+    Builtin     bool     `json:"builtin"`
+    Special     bool     `json:"special,omitempty"` // let, defun, help...
+}
+
+func NewFunctionInfo(f *parser.Function) FunctionInfo {
+    return FunctionInfo{
+        Name:        f.Id,
+        Signature:   f.Type.Signature(f.Id),
+        Syntax:      f.Doc.Syntax,
+        Description: f.Doc.Description,
+        Examples:    f.Doc.Examples,
+        Builtin:     f.Builtin,
+    }
+}
+
+// existing interpreter state, nil if there is none
+func (sv *Server) peekInterpSession(authKey string) *InterpSession {
+    sv.stateMu.Lock()
+    defer sv.stateMu.Unlock()
+    return sv.States[authKey]
+}
+
+// special forms, built-ins and functions defined in caller's workspace
+func (sv *Server) HandleFunctions(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+        return
+    }
+
+    var funcs []parser.Function
+    if sess, ok := sv.OptionalAuth(r); ok {
+        if isess := sv.peekInterpSession(sess.AuthKey); isess != nil {
+            isess.mu.Lock()
+            funcs = append(funcs, isess.gs.Funcs...)
+            isess.mu.Unlock()
+        }
+    }
+    if funcs == nil {
+        funcs = parser.GospInit().Funcs
+    }
+
+    items := make([]FunctionInfo, 0, len(parser.SpecialForms) + len(funcs))
+    for _, form := range parser.SpecialForms {
+        items = append(items, FunctionInfo{
+            Name:        form.Id,
+            Syntax:      form.Doc.Syntax,
+            Description: form.Doc.Description,
+            Examples:    form.Doc.Examples,
+            Builtin:     true,
+            Special:     true,
+        })
+    }
+    for i := range funcs {
+        items = append(items, NewFunctionInfo(&funcs[i]))
+    }
+    WriteJSON(w, http.StatusOK, map[string]any{
+        "items": items,
+    })
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/Fipaan/gosp/parser"
+)
+
+// Evaluates arbitrary input, golden inputs are the seed corpus.
+// EvalTS must return, report error location inside of source
+// and leave no error in GospState.
+// One run is bounded by 100ms context, parser.DefaultMaxDepth and parser.MaxNesting.
+// Execs stop while new input is minimized, -fuzzminimizetime 5s keeps it short.
+func FuzzEvalTS(f *testing.F) {
+    inputs, _ := filepath.Glob(filepath.Join("testdata", "golden", "*", "*.gosp"))
+    for _, input := range inputs {
+        src, err := os.ReadFile(input)
+        if err != nil { f.Fatal(err) }
+        f.Add(string(src))
+    }
+    f.Add("(defun f (x double) (map f [x]))")
+    f.Add("(profile (map (let y 1.0 head) [[1.0] [2.0]]))")
+
+    f.Fuzz(func(t *testing.T, src string) {
+        p := parser.ParserInit()
+        p.AddSourceNamed("fuzz", src)
+        gs := parser.GospInit()
+        ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+        defer cancel()
+        gs.Ctx = ctx
+
+        _, firstLoc, _ := EvalTS(&p, &gs)
+        if gs.Err != nil { t.Fatalf("error left in state: %s", gs.Err) }
+        if firstLoc == nil { return }
+        lines := strings.Count(src, "\n") + 1
+        if firstLoc.Source != "fuzz" || firstLoc.Line < 1 || firstLoc.Line > lines || firstLoc.Column < 1 {
+            t.Fatalf("error location %s is outside of source with %d lines", firstLoc.Loc(), lines)
+        }
+    })
+}
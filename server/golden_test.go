@@ -0,0 +1,69 @@
+package server
+
+import (
+    "flag"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/Fipaan/gosp/parser"
+)
+
+var update = flag.Bool("update", false, "rewrite .golden files with current output")
+
+// Each testdata/golden/**/name.gosp is evaluated with EvalTS,
+// transcript and first error location are compared with name.golden
+func TestGolden(t *testing.T) {
+    root := filepath.Join("testdata", "golden")
+    var inputs []string
+    err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+        if err != nil { return err }
+        if !d.IsDir() && strings.HasSuffix(path, ".gosp") {
+            inputs = append(inputs, path)
+        }
+        return nil
+    })
+    if err != nil { t.Fatal(err) }
+    if len(inputs) == 0 { t.Fatalf("no inputs in %s", root) }
+
+    for _, input := range inputs {
+        name, _ := filepath.Rel(root, input)
+        name = filepath.ToSlash(name)
+        t.Run(strings.TrimSuffix(name, ".gosp"), func(t *testing.T) {
+            src, err := os.ReadFile(input)
+            if err != nil { t.Fatal(err) }
+            got := evalTranscript(name, string(src))
+
+            golden := strings.TrimSuffix(input, ".gosp") + ".golden"
+            if *update {
+                if err := os.WriteFile(golden, []byte(got), 0644); err != nil { t.Fatal(err) }
+                return
+            }
+            want, err := os.ReadFile(golden)
+            if err != nil { t.Fatalf("%s (run `go test ./server -run TestGolden -update`)", err) }
+            if got != string(want) {
+                t.Errorf("output differs from %s\n--- got:\n%s\n--- want:\n%s", golden, got, want)
+            }
+        })
+    }
+}
+
+func evalTranscript(source, text string) string {
+    p := parser.ParserInit()
+    p.AddSourceNamed(source, text)
+    gs := parser.GospInit()
+    out, firstLoc, err := EvalTS(&p, &gs)
+
+    var b strings.Builder
+    b.WriteString(out)
+    b.WriteString("----\n")
+    switch {
+    case err != nil:      fmt.Fprintf(&b, "interrupted: %s\n", err.Error())
+    case firstLoc != nil: fmt.Fprintf(&b, "first error: %s\n", firstLoc.Loc())
+    default:              b.WriteString("ok\n")
+    }
+    return b.String()
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// details of failures are logged only, /readyz is unauthenticated
+type CheckResult struct {
+    Status     string  `json:"status"` // "ok" or "failed"
+    DurationMs float64 `json:"durationMs,omitempty"`
+}
+
+func checkStatus(ok bool) string {
+    if ok { return "ok" }
+    return "failed"
+}
+
+// process is alive, doesn't touch storage
+func (sv *Server) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodHead {
+        WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+        return
+    }
+    WriteJSON(w, http.StatusOK, map[string]any{
+        "status": "ok",
+        "uptime": Duration(time.Since(sv.StartedAt).Round(time.Second)),
+    })
+}
+
+// Readiness is reported as not ready from start of shutdown.
+func (sv *Server) StartDraining() {
+    sv.draining.Store(true)
+}
+
+func (sv *Server) Draining() bool {
+    return sv.draining.Load()
+}
+
+func runCheck(ctx context.Context, name string, check func(context.Context) error) CheckResult {
+    start := time.Now()
+    err   := check(ctx)
+    if err != nil {
+        storageLog.Warn("readiness check failed", "check", name, "error", err)
+    }
+    return CheckResult{
+        Status:     checkStatus(err == nil),
+        DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+    }
+}
+
+// storage is reachable, its indexes exist and server is not draining
+func (sv *Server) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodHead {
+        WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+        return
+    }
+
+    checks := map[string]CheckResult{
+        "draining": {Status: checkStatus(!sv.Draining())},
+    }
+    if !sv.Draining() {
+        ctx, cancel := sv.WithTimeout(r)
+        defer cancel()
+
+        checks["storage"] = runCheck(ctx, "storage", sv.DB.Ping)
+        if checks["storage"].Status == "ok" {
+            checks["indexes"] = runCheck(ctx, "indexes", sv.DB.CheckIndexes)
+        } else {
+            checks["indexes"] = CheckResult{Status: checkStatus(false)}
+        }
+    }
+
+    status, code := "ready", http.StatusOK
+    for _, c := range checks {
+        if c.Status != "ok" {
+            status, code = "not ready", http.StatusServiceUnavailable
+        }
+    }
+    WriteJSON(w, code, map[string]any{
+        "status": status,
+        "checks": checks,
+    })
+}
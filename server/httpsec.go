@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// request came over TLS, directly or through trusted proxy
+func (sv *Server) IsSecure(r *http.Request) bool {
+    if r.TLS != nil { return true }
+    return sv.TrustProxy && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// "*" allows any origin, but without credentials
+func (sv *Server) originAllowed(origin string) (ok, credentials bool) {
+    if slices.Contains(sv.CORSOrigins, origin) { return true, true }
+    return slices.Contains(sv.CORSOrigins, "*"), false
+}
+
+var (
+    corsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete}
+    corsHeaders = []string{"Content-Type", "Authorization", "X-Auth-Key", CSRFHeader, RequestIDHeader}
+    corsExposed = []string{"X-Auth-Key", CSRFHeader, RequestIDHeader, "Retry-After"}
+)
+
+// Answers preflight requests and marks responses readable by allowed
+// origins. Strict-Transport-Security is set on secure responses.
+func (sv *Server) CORS(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if sv.HSTSMaxAge > 0 && sv.IsSecure(r) {
+            w.Header().Set("Strict-Transport-Security",
+                           "max-age=" + strconv.FormatInt(int64(sv.HSTSMaxAge / time.Second), 10))
+        }
+
+        origin := r.Header.Get("Origin")
+        if origin == "" {
+            next.ServeHTTP(w, r)
+            return
+        }
+        w.Header().Add("Vary", "Origin")
+        ok, credentials := sv.originAllowed(origin)
+        preflight := r.Method == http.MethodOptions &&
+                     r.Header.Get("Access-Control-Request-Method") != ""
+        if !ok {
+            if preflight {
+                WriteAPIError(w, http.StatusForbidden, nil, "origin %s is not allowed", origin)
+                return
+            }
+            // browser hides the response
+            next.ServeHTTP(w, r)
+            return
+        }
+
+        h := w.Header()
+        if credentials {
+            h.Set("Access-Control-Allow-Origin", origin)
+            h.Set("Access-Control-Allow-Credentials", "true")
+        } else {
+            h.Set("Access-Control-Allow-Origin", "*")
+        }
+        if !preflight {
+            h.Set("Access-Control-Expose-Headers", strings.Join(corsExposed, ", "))
+            next.ServeHTTP(w, r)
+            return
+        }
+        h.Add("Vary", "Access-Control-Request-Method")
+        h.Add("Vary", "Access-Control-Request-Headers")
+        h.Set("Access-Control-Allow-Methods", strings.Join(corsMethods, ", "))
+        h.Set("Access-Control-Allow-Headers", strings.Join(corsHeaders, ", "))
+        h.Set("Access-Control-Max-Age", "600")
+        w.WriteHeader(http.StatusNoContent)
+    })
+}
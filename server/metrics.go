@@ -0,0 +1,258 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimal metrics in Prometheus text exposition format (version 0.0.4).
+
+type metric interface {
+    write(w io.Writer)
+}
+
+var (
+    metricsMu sync.Mutex
+    registry  []metric
+)
+
+func register(m metric) {
+    metricsMu.Lock()
+    registry = append(registry, m)
+    metricsMu.Unlock()
+}
+
+// values of labels, joined by 0xff byte
+type labelKey string
+
+func makeLabelKey(values []string) labelKey {
+    return labelKey(strings.Join(values, "\xff"))
+}
+
+func formatLabels(names []string, key labelKey, extra ...string) string {
+    var values []string
+    if len(names) > 0 { values = strings.Split(string(key), "\xff") }
+    var b strings.Builder
+    for i, name := range names {
+        if b.Len() > 0 { b.WriteByte(',') }
+        fmt.Fprintf(&b, "%s=%s", name, quoteLabel(values[i]))
+    }
+    for i := 0; i + 1 < len(extra); i += 2 {
+        if b.Len() > 0 { b.WriteByte(',') }
+        fmt.Fprintf(&b, "%s=%s", extra[i], quoteLabel(extra[i+1]))
+    }
+    if b.Len() == 0 { return "" }
+    return "{" + b.String() + "}"
+}
+
+func quoteLabel(v string) string {
+    v = strings.ReplaceAll(v, `\`, `\\`)
+    v = strings.ReplaceAll(v, `"`, `\"`)
+    v = strings.ReplaceAll(v, "\n", `\n`)
+    return `"` + v + `"`
+}
+
+func formatFloat(v float64) string {
+    switch {
+    case math.IsInf(v, 1):  return "+Inf"
+    case math.IsInf(v, -1): return "-Inf"
+    }
+    return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+    fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sortedKeys[V any](m map[labelKey]V) []labelKey {
+    keys := make([]labelKey, 0, len(m))
+    for k := range m { keys = append(keys, k) }
+    slices.Sort(keys)
+    return keys
+}
+
+type CounterVec struct {
+    Name   string
+    Help   string
+    Labels []string
+
+    mu     sync.Mutex
+    values map[labelKey]float64
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+    c := &CounterVec{Name: name, Help: help, Labels: labels}
+    register(c)
+    return c
+}
+
+func (c *CounterVec) Add(v float64, labels ...string) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.values == nil { c.values = make(map[labelKey]float64) }
+    c.values[makeLabelKey(labels)] += v
+}
+
+func (c *CounterVec) Inc(labels ...string) {
+    c.Add(1, labels...)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    writeHeader(w, c.Name, c.Help, "counter")
+    for _, key := range sortedKeys(c.values) {
+        fmt.Fprintf(w, "%s%s %s\n", c.Name, formatLabels(c.Labels, key), formatFloat(c.values[key]))
+    }
+}
+
+// in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type histogram struct {
+    counts []uint64 // per bucket, not cumulative
+    sum    float64
+    count  uint64
+}
+
+type HistogramVec struct {
+    Name    string
+    Help    string
+    Labels  []string
+    Buckets []float64 // upper bounds, ascending
+
+    mu     sync.Mutex
+    values map[labelKey]*histogram
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+    h := &HistogramVec{Name: name, Help: help, Labels: labels, Buckets: buckets}
+    register(h)
+    return h
+}
+
+func (h *HistogramVec) Observe(v float64, labels ...string) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    if h.values == nil { h.values = make(map[labelKey]*histogram) }
+    key := makeLabelKey(labels)
+    hist := h.values[key]
+    if hist == nil {
+        hist = &histogram{counts: make([]uint64, len(h.Buckets))}
+        h.values[key] = hist
+    }
+    if i, _ := slices.BinarySearch(h.Buckets, v); i < len(h.Buckets) {
+        hist.counts[i]++
+    }
+    hist.sum   += v
+    hist.count += 1
+}
+
+func (h *HistogramVec) ObserveSince(start time.Time, labels ...string) {
+    h.Observe(time.Since(start).Seconds(), labels...)
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    writeHeader(w, h.Name, h.Help, "histogram")
+    for _, key := range sortedKeys(h.values) {
+        hist := h.values[key]
+        var cum uint64
+        for i, le := range h.Buckets {
+            cum += hist.counts[i]
+            fmt.Fprintf(w, "%s_bucket%s %d\n", h.Name,
+                        formatLabels(h.Labels, key, "le", formatFloat(le)), cum)
+        }
+        fmt.Fprintf(w, "%s_bucket%s %d\n", h.Name,
+                    formatLabels(h.Labels, key, "le", "+Inf"), hist.count)
+        fmt.Fprintf(w, "%s_sum%s %s\n", h.Name, formatLabels(h.Labels, key), formatFloat(hist.sum))
+        fmt.Fprintf(w, "%s_count%s %d\n", h.Name, formatLabels(h.Labels, key), hist.count)
+    }
+}
+
+// gauge which is computed when metrics are scraped
+type GaugeFunc struct {
+    Name string
+    Help string
+    Fn   func() float64
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+    writeHeader(w, g.Name, g.Help, "gauge")
+    fmt.Fprintf(w, "%s %s\n", g.Name, formatFloat(g.Fn()))
+}
+
+var (
+    metricHTTPRequests = NewCounterVec("gosp_http_requests_total",
+        "HTTP requests by route, method and status.", "route", "method", "status")
+    metricHTTPDuration = NewHistogramVec("gosp_http_request_duration_seconds",
+        "HTTP request latency by route and method.", DefBuckets, "route", "method")
+    metricEvals = NewCounterVec("gosp_evaluations_total",
+        "Evaluation requests.")
+    metricEvalDuration = NewHistogramVec("gosp_evaluation_duration_seconds",
+        "Duration of evaluation requests.", DefBuckets)
+    metricEvalErrors = NewCounterVec("gosp_evaluation_errors_total",
+        "Evaluation errors by kind (parse, assert, depth, timeout, canceled, internal).", "kind")
+    metricLogins = NewCounterVec("gosp_logins_total",
+        "Login attempts by result (success, invalid, locked, disabled).", "result")
+    metricStorageDuration = NewHistogramVec("gosp_storage_command_duration_seconds",
+        "Latency of storage commands by command and outcome.", DefBuckets, "command", "outcome")
+)
+
+// label of method, unknown methods are merged so clients can't add series
+func methodLabel(r *http.Request) string {
+    switch r.Method {
+    case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+         http.MethodPatch, http.MethodDelete, http.MethodOptions:
+        return r.Method
+    }
+    return "other"
+}
+
+// label of route, bounded by registered patterns
+func routeLabel(r *http.Request) string {
+    if r.Pattern == "" { return "unmatched" }
+    return r.Pattern
+}
+
+func (sv *Server) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+        return
+    }
+
+    interps := &GaugeFunc{
+        Name: "gosp_interp_sessions",
+        Help: "Live interpreter sessions.",
+        Fn: func() float64 {
+            sv.stateMu.Lock()
+            defer sv.stateMu.Unlock()
+            return float64(len(sv.States))
+        },
+    }
+    uptime := &GaugeFunc{
+        Name: "gosp_uptime_seconds",
+        Help: "Time since server start.",
+        Fn:   func() float64 { return time.Since(sv.StartedAt).Seconds() },
+    }
+
+    metricsMu.Lock()
+    metrics := slices.Clone(registry)
+    metricsMu.Unlock()
+
+    var b strings.Builder
+    for _, m := range append(metrics, interps, uptime) {
+        m.write(&b)
+    }
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+    w.WriteHeader(http.StatusOK)
+    io.WriteString(w, b.String())
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// per-request data, filled while request is handled and logged afterwards
+type requestInfo struct {
+    ID       string // generated by server
+    ClientID string // X-Request-ID of client, can't be trusted
+    Username string
+}
+
+type requestInfoKey struct{}
+
+func getRequestInfo(r *http.Request) *requestInfo {
+    info, _ := r.Context().Value(requestInfoKey{}).(*requestInfo)
+    return info
+}
+
+func RequestID(r *http.Request) string {
+    if info := getRequestInfo(r); info != nil {
+        return info.ID
+    }
+    return ""
+}
+
+func ClientRequestID(r *http.Request) string {
+    if info := getRequestInfo(r); info != nil {
+        return info.ClientID
+    }
+    return ""
+}
+
+// remembers authenticated user for access log
+func setRequestUser(r *http.Request, username string) {
+    if info := getRequestInfo(r); info != nil {
+        info.Username = username
+    }
+}
+
+func newRequestID() string {
+    var b [8]byte
+    if _, err := rand.Read(b[:]); err != nil {
+        return fmt.Sprintf("%x", time.Now().UnixNano())
+    }
+    return hex.EncodeToString(b[:])
+}
+
+// client-provided ids are recorded if they are short and printable
+func validRequestID(id string) bool {
+    if id == "" || len(id) > 128 { return false }
+    for _, c := range []byte(id) {
+        if c <= ' ' || c > '~' { return false }
+    }
+    return true
+}
+
+// records status and size of response
+type statusWriter struct {
+    http.ResponseWriter
+    status int
+    bytes  int64
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+    if sw.status == 0 { sw.status = status }
+    sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+    if sw.status == 0 { sw.status = http.StatusOK }
+    n, err := sw.ResponseWriter.Write(b)
+    sw.bytes += int64(n)
+    return n, err
+}
+
+// for http.ResponseController
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+    return sw.ResponseWriter
+}
+
+// Assigns request id, recovers from panics and writes access log record.
+func (sv *Server) AccessLog(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        info  := &requestInfo{ID: newRequestID()}
+        if id := r.Header.Get(RequestIDHeader); validRequestID(id) {
+            info.ClientID = id
+        }
+        w.Header().Set(RequestIDHeader, info.ID)
+        r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info))
+
+        sw := &statusWriter{ResponseWriter: w}
+        defer func() {
+            if rec := recover(); rec != nil {
+                if rec == http.ErrAbortHandler { panic(rec) }
+                serverLog.Error("panic", "requestId", info.ID, "error", fmt.Sprint(rec))
+                if sw.status == 0 {
+                    WriteAPIError(sw, http.StatusInternalServerError, nil, "internal server error")
+                }
+            }
+            if sw.status == 0 { sw.status = http.StatusOK }
+            metricHTTPRequests.Inc(routeLabel(r), methodLabel(r), strconv.Itoa(sw.status))
+            metricHTTPDuration.ObserveSince(start, routeLabel(r), methodLabel(r))
+            serverLog.Info("request",
+                "requestId",       info.ID,
+                "clientRequestId", info.ClientID,
+                "method",          r.Method,
+                "path",            r.URL.Path,
+                "status",          sw.status,
+                "bytes",           sw.bytes,
+                "durationMs",      float64(time.Since(start).Microseconds()) / 1000,
+                "user",            info.Username,
+                "remote",          sv.ClientIP(r))
+        }()
+        next.ServeHTTP(sw, r)
+    })
+}
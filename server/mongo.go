@@ -5,6 +5,9 @@ import (
 	"time"
     "context"
     "errors"
+    "slices"
+    "strings"
+    "sync"
 
     "crypto/hmac"
 	"crypto/sha256"
@@ -15,7 +18,9 @@ import (
     "go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	mopts "go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/event"
 )
 
 type UserDoc struct {
@@ -23,6 +28,22 @@ type UserDoc struct {
 	Username  string             `bson:"username"`
 	PassHash  string             `bson:"passHash"`
 	CreatedAt time.Time          `bson:"createdAt"`
+
+	Role      string             `bson:"role,omitempty"` // empty is RoleUser
+	Disabled  bool               `bson:"disabled,omitempty"`
+
+	FailedLogins int       `bson:"failedLogins,omitempty"`
+	LockedUntil  time.Time `bson:"lockedUntil,omitempty"`
+}
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+func (u *UserDoc) GetRole() string {
+	if u.Role == "" { return RoleUser }
+	return u.Role
 }
 
 type SessionDoc struct {
@@ -32,6 +53,54 @@ type SessionDoc struct {
 	CreatedAt  time.Time          `bson:"createdAt"`
 	LastUsedAt time.Time          `bson:"lastUsedAt"`
 	ExpiresAt  time.Time          `bson:"expiresAt"`
+
+	// set when authenticated with API token instead of session
+	Token *TokenDoc `bson:"-"`
+}
+
+// API token, only its hash is stored
+type TokenDoc struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Username   string             `bson:"username"`
+	Name       string             `bson:"name"`
+	Hash       string             `bson:"hash"`
+	Scopes     []string           `bson:"scopes,omitempty"` // empty means full access
+	CreatedAt  time.Time          `bson:"createdAt"`
+	LastUsedAt time.Time          `bson:"lastUsedAt,omitempty"`
+	ExpiresAt  time.Time          `bson:"expiresAt,omitempty"` // zero never expires
+}
+
+type SnippetDoc struct {
+	ID         string    `bson:"_id"`
+	Owner      string    `bson:"owner"`
+	Expr       string    `bson:"expr"`
+	Transcript string    `bson:"transcript,omitempty"`
+	Visibility string    `bson:"visibility"`
+	CreatedAt  time.Time `bson:"createdAt"`
+}
+
+// Security-relevant event, audit collection is append-only:
+// documents are only removed by TTL monitor once expiresAt passes
+type AuditDoc struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty"`
+	At              time.Time          `bson:"at"`
+	Event           string             `bson:"event"`
+	Username        string             `bson:"username,omitempty"` // who did it, attempted name for failed login
+	Target          string             `bson:"target,omitempty"`   // user affected by admin action
+	Details         map[string]string  `bson:"details,omitempty"`
+	IP              string             `bson:"ip,omitempty"`
+	UserAgent       string             `bson:"userAgent,omitempty"`
+	RequestID       string             `bson:"requestId,omitempty"`
+	ClientRequestID string             `bson:"clientRequestId,omitempty"` // supplied by client, may be forged
+	ExpiresAt       time.Time          `bson:"expiresAt,omitempty"` // zero is kept forever
+}
+
+type AuditFilter struct {
+	Username string    // matches username or target
+	Event    string
+	IP       string
+	Since    time.Time // inclusive, zero is unbounded
+	Until    time.Time // exclusive, zero is unbounded
 }
 
 type HistoryDoc struct {
@@ -42,11 +111,20 @@ type HistoryDoc struct {
 	Result   string             `bson:"result"`
 }
 
+var (
+	ErrInvalidPassword  = errors.New("Invalid password")
+	ErrAccountDisabled  = errors.New("Account is disabled")
+)
+
 type Storage struct {
 	db       *mongo.Database
 	users    *mongo.Collection
 	sessions *mongo.Collection
 	history  *mongo.Collection
+	limits   *mongo.Collection
+	tokens   *mongo.Collection
+	snippets *mongo.Collection
+	audit    *mongo.Collection
 	secret   []byte
 }
 
@@ -61,10 +139,31 @@ func IndexUnique(col *mongo.Collection, ctx context.Context, key string) error {
     return nil
 }
 
+// records latency of storage commands
+func commandMonitor() *event.CommandMonitor {
+    return &event.CommandMonitor{
+        Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+            metricStorageDuration.Observe(e.Duration.Seconds(), e.CommandName, "ok")
+            storageLog.Debug("command",
+                "command",    e.CommandName,
+                "durationMs", float64(e.Duration.Microseconds()) / 1000)
+        },
+        Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+            metricStorageDuration.Observe(e.Duration.Seconds(), e.CommandName, "error")
+            storageLog.Warn("command failed",
+                "command",    e.CommandName,
+                "durationMs", float64(e.Duration.Microseconds()) / 1000,
+                "error",      e.Failure)
+        },
+    }
+}
+
 func NewStore(ctx context.Context, mongoURI, dbName string,
               secret []byte) (sdb Storage, closeFn func(context.Context) error, err error) {
 	var client *mongo.Client
-    client, err = mongo.Connect(ctx, mopts.Client().ApplyURI(mongoURI))
+    client, err = mongo.Connect(ctx, mopts.Client().
+                                ApplyURI(mongoURI).
+                                SetMonitor(commandMonitor()))
 	if err != nil {	return }
 	closeFn = func(c context.Context) error { return client.Disconnect(c) }
 
@@ -74,6 +173,10 @@ func NewStore(ctx context.Context, mongoURI, dbName string,
 		users:    db.Collection("users"),
 		sessions: db.Collection("sessions"),
 		history:  db.Collection("history"),
+		limits:   db.Collection("ratelimits"),
+		tokens:   db.Collection("tokens"),
+		snippets: db.Collection("snippets"),
+		audit:    db.Collection("audit"),
 		secret:   secret,
 	}
 
@@ -84,6 +187,12 @@ func NewStore(ctx context.Context, mongoURI, dbName string,
     }
 
     err = IndexUnique(sdb.sessions, ctx, "authKey")
+    if err != nil {
+        closeFn(ctx)
+        return
+    }
+
+    err = IndexUnique(sdb.tokens, ctx, "hash")
     if err != nil {
         closeFn(ctx)
         return
@@ -107,8 +216,65 @@ func NewStore(ctx context.Context, mongoURI, dbName string,
 			{Key: "at", Value: -1},
 		},
 	})
-	if err != nil { closeFn(ctx) }
+	if err != nil {
+		closeFn(ctx)
+		return
+	}
 
+	_, err = sdb.tokens.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "username", Value: 1}},
+	})
+	if err != nil {
+		closeFn(ctx)
+		return
+	}
+
+	// tokens without expiresAt are never removed
+	_, err = sdb.tokens.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "expiresAt", Value: 1}},
+		Options: mopts.Index().
+			SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		closeFn(ctx)
+		return
+	}
+
+	_, err = sdb.snippets.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "owner", Value: 1},
+			{Key: "createdAt", Value: -1},
+		},
+	})
+	if err != nil {
+		closeFn(ctx)
+		return
+	}
+
+	// buckets are dropped once they would be full again
+	_, err = sdb.limits.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "expiresAt", Value: 1}},
+		Options: mopts.Index().
+			SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		closeFn(ctx)
+		return
+	}
+
+	_, err = sdb.audit.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "at", Value: -1}}},
+		{Keys: bson.D{{Key: "username", Value: 1}, {Key: "at", Value: -1}}},
+		{Keys: bson.D{{Key: "target", Value: 1}, {Key: "at", Value: -1}}},
+		// retention, events without expiresAt are kept
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: mopts.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		closeFn(ctx)
+		return
+	}
+
+	storageLog.Info("connected", "db", dbName)
 	return
 }
 
@@ -146,21 +312,202 @@ func (db *Storage) CreateUser(ctx context.Context, username, pass string) error
 	return nil
 }
 
+// compared with password of unknown user, so that it takes as long as known one
+var dummyHash = sync.OnceValue(func() []byte {
+    hash, _ := bcrypt.GenerateFromPassword([]byte("gosp"), bcrypt.DefaultCost)
+    return hash
+})
+
+// Password is compared first: state of account is revealed only with
+// correct password, wrong one gives ErrInvalidPassword whatever the state.
 func (db *Storage) VerifyUser(ctx context.Context, username, pass string) (exists bool, err error) {
 	var u UserDoc
     err    = db.users.FindOne(ctx, bson.M{"username": username}).Decode(&u)
     exists = err == nil
-    if exists {
-        err = bcrypt.CompareHashAndPassword([]byte(u.PassHash), []byte(pass))
-        if err == bcrypt.ErrMismatchedHashAndPassword {
-            err = fmt.Errorf("Invalid password")
-        }
-	} else if errors.Is(err, mongo.ErrNoDocuments) {
-	    err = nil
+    if !exists {
+        if errors.Is(err, mongo.ErrNoDocuments) { err = nil }
+        bcrypt.CompareHashAndPassword(dummyHash(), []byte(pass))
+        return
+    }
+    err = bcrypt.CompareHashAndPassword([]byte(u.PassHash), []byte(pass))
+    switch {
+    case err == bcrypt.ErrMismatchedHashAndPassword:
+        err = ErrInvalidPassword
+    case err != nil:
+    case u.Disabled:
+        err = ErrAccountDisabled
+    case u.LockedUntil.After(time.Now()):
+        err = &LockedError{Until: u.LockedUntil}
     }
 	return
 }
 
+func (db *Storage) GetUser(ctx context.Context, username string) (u UserDoc, exists bool, err error) {
+	err    = db.users.FindOne(ctx, bson.M{"username": username}).Decode(&u)
+	exists = err == nil
+    if !exists && errors.Is(err, mongo.ErrNoDocuments) {
+		err = nil
+	}
+	return
+}
+
+func (db *Storage) ListUsers(ctx context.Context, skip, limit int64) (docs []UserDoc, err error) {
+    var cur *mongo.Cursor
+	cur, err = db.users.Find(ctx, bson.M{},
+		mopts.Find().
+			SetSort(bson.D{{Key: "username", Value: 1}}).
+			SetSkip(skip).
+			SetLimit(limit),
+	)
+	if err != nil { return }
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var u UserDoc
+        err = cur.Decode(&u)
+		if err != nil { return }
+		docs = append(docs, u)
+	}
+    err = cur.Err()
+	return
+}
+
+func (db *Storage) updateUser(ctx context.Context, username string, set bson.M) (exists bool, err error) {
+	res, err := db.users.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": set})
+	if err != nil { return }
+	return res.MatchedCount > 0, nil
+}
+
+func (db *Storage) SetUserRole(ctx context.Context, username, role string) (exists bool, err error) {
+	return db.updateUser(ctx, username, bson.M{"role": role})
+}
+
+func (db *Storage) SetUserDisabled(ctx context.Context, username string, disabled bool) (exists bool, err error) {
+	return db.updateUser(ctx, username, bson.M{"disabled": disabled})
+}
+
+func (db *Storage) Ping(ctx context.Context) error {
+	return db.db.Client().Ping(ctx, readpref.Primary())
+}
+
+// names of indexes created by NewStore
+func (db *Storage) expectedIndexes() map[*mongo.Collection][]string {
+	return map[*mongo.Collection][]string{
+		db.users:    {"username_1"},
+		db.sessions: {"authKey_1", "expiresAt_1"},
+		db.history:  {"username_1_at_-1"},
+		db.tokens:   {"hash_1", "username_1", "expiresAt_1"},
+		db.snippets: {"owner_1_createdAt_-1"},
+		db.limits:   {"expiresAt_1"},
+	}
+}
+
+// reports indexes which are missing, e.g. dropped after start
+func (db *Storage) CheckIndexes(ctx context.Context) error {
+	var missing []string
+	for col, names := range db.expectedIndexes() {
+		specs, err := col.Indexes().ListSpecifications(ctx)
+		if err != nil { return err }
+		for _, name := range names {
+			if !slices.ContainsFunc(specs, func(s *mongo.IndexSpecification) bool {
+				return s.Name == name
+			}) {
+				missing = append(missing, col.Name() + "." + name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return fmt.Errorf("missing indexes: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+type StorageStats struct {
+	Users    int64 `json:"users"`
+	Sessions int64 `json:"sessions"`
+	Tokens   int64 `json:"tokens"`
+	History  int64 `json:"history"`
+	Audit    int64 `json:"audit"`
+}
+
+func (db *Storage) Stats(ctx context.Context) (st StorageStats, err error) {
+	st.Users, err = db.users.CountDocuments(ctx, bson.M{})
+	if err != nil { return }
+	st.Sessions, err = db.sessions.CountDocuments(ctx,
+		bson.M{"expiresAt": bson.M{"$gt": time.Now()}})
+	if err != nil { return }
+	st.Tokens, err = db.tokens.EstimatedDocumentCount(ctx)
+	if err != nil { return }
+	st.History, err = db.history.EstimatedDocumentCount(ctx)
+	if err != nil { return }
+	st.Audit, err = db.audit.EstimatedDocumentCount(ctx)
+	return
+}
+
+// Counts failed login, locks account once maxFailed is reached.
+// Returns non-zero lockedUntil if account got locked.
+func (db *Storage) LoginFailed(ctx context.Context, username string, maxFailed int,
+                               lockFor time.Duration) (lockedUntil time.Time, err error) {
+	var u UserDoc
+	opts := mopts.FindOneAndUpdate().SetReturnDocument(mopts.After)
+	err   = db.users.FindOneAndUpdate(ctx,
+		bson.M{"username": username},
+		bson.M{"$inc": bson.M{"failedLogins": 1}},
+		opts,
+	).Decode(&u)
+	if errors.Is(err, mongo.ErrNoDocuments) { return lockedUntil, nil }
+	if err != nil || u.FailedLogins < maxFailed { return }
+
+	lockedUntil = time.Now().Add(lockFor)
+	_, err = db.users.UpdateOne(ctx,
+		bson.M{"username": username},
+		bson.M{"$set": bson.M{"failedLogins": 0, "lockedUntil": lockedUntil}},
+	)
+	return
+}
+
+func (db *Storage) ResetLoginFailures(ctx context.Context, username string) error {
+	_, err := db.users.UpdateOne(ctx,
+		bson.M{"username": username, "failedLogins": bson.M{"$gt": 0}},
+		bson.M{"$set": bson.M{"failedLogins": 0}},
+	)
+	return err
+}
+
+func (db *Storage) SetPassword(ctx context.Context, username, pass string) error {
+	hash, err := HashPassword(pass)
+	if err != nil {
+		return err
+	}
+	res, err := db.users.UpdateOne(ctx,
+		bson.M{"username": username},
+		bson.M{"$set": bson.M{"passHash": hash}},
+	)
+	if err != nil { return err }
+	if res.MatchedCount == 0 { return mongo.ErrNoDocuments }
+	return nil
+}
+
+// Removes user with all of its sessions, tokens, snippets and history.
+// Returns authKeys of removed sessions, so caller can drop interpreter state.
+// user is deleted first, so login can't create session while
+// sessions and tokens are cleaned up
+func (db *Storage) DeleteUser(ctx context.Context, username string) (authKeys []string, err error) {
+	_, err = db.users.DeleteOne(ctx, bson.M{"username": username})
+    if err != nil { return }
+    authKeys, err = db.DeleteSessions(ctx, username, "")
+    if err != nil { return }
+    var tokenKeys []string
+    tokenKeys, err = db.DeleteTokens(ctx, username)
+    authKeys = append(authKeys, tokenKeys...)
+    if err != nil { return }
+	_, err = db.history.DeleteMany(ctx, bson.M{"username": username})
+    if err != nil { return }
+	_, err = db.snippets.DeleteMany(ctx, bson.M{"owner": username})
+	return
+}
+
 func (db *Storage) MakeAuthKey(username string) string {
 	issued := time.Now().UTC().Format(time.RFC3339Nano)
 	nonce := make([]byte, 18)
@@ -217,6 +564,296 @@ func (db *Storage) DeleteSession(ctx context.Context, authKey string) error {
 	return err
 }
 
+func (db *Storage) ListSessions(ctx context.Context, username string) (docs []SessionDoc, err error) {
+    var cur *mongo.Cursor
+	cur, err = db.sessions.Find(ctx,
+		bson.M{
+			"username":  username,
+			"expiresAt": bson.M{"$gt": time.Now()},
+		},
+		mopts.Find().SetSort(bson.D{{Key: "lastUsedAt", Value: -1}}),
+	)
+	if err != nil { return }
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var s SessionDoc
+        err = cur.Decode(&s)
+		if err != nil { return }
+		docs = append(docs, s)
+	}
+    err = cur.Err()
+	return
+}
+
+// Deletes session by its id, only if it belongs to username.
+func (db *Storage) DeleteSessionByID(ctx context.Context, username string,
+                                     id primitive.ObjectID) (sess SessionDoc, exists bool, err error) {
+	filter := bson.M{"_id": id, "username": username}
+	err     = db.sessions.FindOneAndDelete(ctx, filter).Decode(&sess)
+	exists  = err == nil
+    if !exists && errors.Is(err, mongo.ErrNoDocuments) {
+		err = nil
+	}
+	return
+}
+
+// Deletes all sessions of username except keepAuthKey (empty keeps nothing).
+// Returns authKeys of deleted sessions.
+func (db *Storage) DeleteSessions(ctx context.Context, username,
+                                  keepAuthKey string) (authKeys []string, err error) {
+	filter := bson.M{"username": username}
+	if keepAuthKey != "" {
+		filter["authKey"] = bson.M{"$ne": keepAuthKey}
+	}
+
+    var cur *mongo.Cursor
+	cur, err = db.sessions.Find(ctx, filter,
+		mopts.Find().SetProjection(bson.M{"authKey": 1}))
+	if err != nil { return }
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var s SessionDoc
+        err = cur.Decode(&s)
+		if err != nil { return }
+		authKeys = append(authKeys, s.AuthKey)
+	}
+    err = cur.Err()
+	if err != nil { return }
+
+	_, err = db.sessions.DeleteMany(ctx, filter)
+	return
+}
+
+// Storage-backed token bucket, updated atomically with pipeline update.
+func (db *Storage) TakeToken(ctx context.Context, key string,
+                             limit RateLimit) (ok bool, retryAfter time.Duration, err error) {
+	now   := time.Now()
+	burst := float64(limit.Burst)
+	// time to refill bucket from empty state
+	full  := time.Duration(burst / limit.Rate * float64(time.Second))
+
+	elapsedMs := bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$at", now}}}}
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"tokens": bson.M{"$min": bson.A{burst, bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$tokens", burst}},
+				bson.M{"$multiply": bson.A{elapsedMs, limit.Rate / 1000}},
+			}}}},
+			"at": now,
+		}},
+		bson.M{"$set": bson.M{
+			"allowed": bson.M{"$gte": bson.A{"$tokens", 1}},
+		}},
+		bson.M{"$set": bson.M{
+			"tokens": bson.M{"$cond": bson.A{
+				"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens",
+			}},
+			"expiresAt": now.Add(full),
+		}},
+	}
+
+	var b struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	opts := mopts.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(mopts.After)
+	err = db.limits.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&b)
+	if err != nil { return }
+	if !b.Allowed {
+		retryAfter = tokenWait(limit, b.Tokens)
+	}
+	return b.Allowed, retryAfter, nil
+}
+
+const TokenPrefix = "gosp_"
+
+func (db *Storage) HashToken(token string) string {
+	mac := hmac.New(sha256.New, db.secret)
+	mac.Write([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CSRF token bound to session, see checkCSRF
+func (db *Storage) CSRFToken(authKey string) string {
+	return db.HashToken("csrf:" + authKey)
+}
+
+// authKey used for interpreter state of sessions authenticated by token
+func (t *TokenDoc) AuthKey() string {
+	return "token:" + t.ID.Hex()
+}
+
+// Returns plain token, which is not stored anywhere.
+// Zero ttl creates token that never expires.
+func (db *Storage) CreateToken(ctx context.Context, username, name string, scopes []string,
+                               ttl time.Duration) (token string, doc TokenDoc, err error) {
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil { return }
+	token = TokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now()
+	doc = TokenDoc{
+		ID:        primitive.NewObjectID(),
+		Username:  username,
+		Name:      name,
+		Hash:      db.HashToken(token),
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		doc.ExpiresAt = now.Add(ttl)
+	}
+	_, err = db.tokens.InsertOne(ctx, doc)
+	return
+}
+
+func (db *Storage) ListTokens(ctx context.Context, username string) (docs []TokenDoc, err error) {
+    var cur *mongo.Cursor
+	cur, err = db.tokens.Find(ctx,
+		bson.M{"username": username},
+		mopts.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	)
+	if err != nil { return }
+	defer cur.Close(ctx)
+
+	now := time.Now()
+	for cur.Next(ctx) {
+		var t TokenDoc
+        err = cur.Decode(&t)
+		if err != nil { return }
+		// TTL monitor may not have removed it yet
+		if !t.ExpiresAt.IsZero() && t.ExpiresAt.Before(now) { continue }
+		docs = append(docs, t)
+	}
+    err = cur.Err()
+	return
+}
+
+// Ensure token exists and not expired; update lastUsedAt.
+func (db *Storage) TouchToken(ctx context.Context, token string) (doc TokenDoc, exists bool, err error) {
+	now := time.Now()
+	filter := bson.M{
+		"hash": db.HashToken(token),
+		"$or": bson.A{
+			bson.M{"expiresAt": bson.M{"$exists": false}},
+			bson.M{"expiresAt": bson.M{"$gt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{"lastUsedAt": now},
+	}
+
+	opts  := mopts.FindOneAndUpdate().SetReturnDocument(mopts.After)
+	err    = db.tokens.FindOneAndUpdate(ctx, filter, update, opts).Decode(&doc)
+	exists = err == nil
+    if !exists && errors.Is(err, mongo.ErrNoDocuments) {
+		err = nil
+	}
+	return
+}
+
+// Deletes token by its id, only if it belongs to username.
+func (db *Storage) DeleteToken(ctx context.Context, username string,
+                               id primitive.ObjectID) (exists bool, err error) {
+	res, err := db.tokens.DeleteOne(ctx, bson.M{"_id": id, "username": username})
+	if err != nil { return }
+	return res.DeletedCount > 0, nil
+}
+
+// Deletes all tokens of username.
+// Returns authKeys of deleted tokens (see TokenDoc.AuthKey).
+func (db *Storage) DeleteTokens(ctx context.Context, username string) (authKeys []string, err error) {
+	docs, err := db.ListTokens(ctx, username)
+	if err != nil { return }
+	for i := range docs {
+		authKeys = append(authKeys, docs[i].AuthKey())
+	}
+	_, err = db.tokens.DeleteMany(ctx, bson.M{"username": username})
+	return
+}
+
+const snippetIDLen = 12 // ~70 bits
+const snippetIDChars = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// bytes at or above this are rejected, so every char is equally likely
+const snippetIDMax = 256 - 256 % len(snippetIDChars)
+
+func newSnippetID() (string, error) {
+	id  := make([]byte, 0, snippetIDLen)
+	buf := make([]byte, snippetIDLen)
+	for len(id) < snippetIDLen {
+		if _, err := rand.Read(buf); err != nil { return "", err }
+		for _, b := range buf {
+			if int(b) >= snippetIDMax || len(id) == snippetIDLen { continue }
+			id = append(id, snippetIDChars[int(b) % len(snippetIDChars)])
+		}
+	}
+	return string(id), nil
+}
+
+// Stores snippet under new random id, retrying on collision.
+func (db *Storage) CreateSnippet(ctx context.Context, doc SnippetDoc) (id string, err error) {
+	doc.CreatedAt = time.Now()
+	for range 5 {
+		doc.ID, err = newSnippetID()
+		if err != nil { return }
+		_, err = db.snippets.InsertOne(ctx, doc)
+		if !mongo.IsDuplicateKeyError(err) { break }
+	}
+	return doc.ID, err
+}
+
+func (db *Storage) GetSnippet(ctx context.Context, id string) (doc SnippetDoc, exists bool, err error) {
+	err    = db.snippets.FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	exists = err == nil
+    if !exists && errors.Is(err, mongo.ErrNoDocuments) {
+		err = nil
+	}
+	return
+}
+
+func (db *Storage) ListSnippets(ctx context.Context, owner string,
+                                limit int64) (docs []SnippetDoc, err error) {
+    var cur *mongo.Cursor
+	cur, err = db.snippets.Find(ctx,
+		bson.M{"owner": owner},
+		mopts.Find().
+			SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+			SetLimit(limit).
+			SetProjection(bson.M{"transcript": 0}),
+	)
+	if err != nil { return }
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var sn SnippetDoc
+        err = cur.Decode(&sn)
+		if err != nil { return }
+		docs = append(docs, sn)
+	}
+    err = cur.Err()
+	return
+}
+
+func (db *Storage) SetSnippetVisibility(ctx context.Context, owner, id,
+                                        visibility string) (exists bool, err error) {
+	res, err := db.snippets.UpdateOne(ctx,
+		bson.M{"_id": id, "owner": owner},
+		bson.M{"$set": bson.M{"visibility": visibility}},
+	)
+	if err != nil { return }
+	return res.MatchedCount > 0, nil
+}
+
+func (db *Storage) DeleteSnippet(ctx context.Context, owner, id string) (exists bool, err error) {
+	res, err := db.snippets.DeleteOne(ctx, bson.M{"_id": id, "owner": owner})
+	if err != nil { return }
+	return res.DeletedCount > 0, nil
+}
+
 func (db *Storage) AppendHistory(ctx context.Context, username, expr, result string) error {
 	_, err := db.history.InsertOne(ctx, HistoryDoc{
 		Username: username,
@@ -246,3 +883,49 @@ func (db *Storage) GetHistory(ctx context.Context, username string,
     err = cur.Err()
 	return
 }
+
+// Records audit event, it expires after retention, zero keeps it forever
+func (db *Storage) AppendAudit(ctx context.Context, doc AuditDoc, retention time.Duration) error {
+	doc.ID = primitive.NilObjectID
+	if doc.At.IsZero() { doc.At = time.Now() }
+	if retention > 0 { doc.ExpiresAt = doc.At.Add(retention) }
+	_, err := db.audit.InsertOne(ctx, doc)
+	return err
+}
+
+// audit events matching filter, newest first
+func (db *Storage) ListAudit(ctx context.Context, f AuditFilter,
+                             skip, limit int64) (docs []AuditDoc, err error) {
+	filter := bson.M{}
+	if f.Username != "" {
+		filter["$or"] = bson.A{
+			bson.M{"username": f.Username},
+			bson.M{"target":   f.Username},
+		}
+	}
+	if f.Event != "" { filter["event"] = f.Event }
+	if f.IP    != "" { filter["ip"]    = f.IP }
+	at := bson.M{}
+	if !f.Since.IsZero() { at["$gte"] = f.Since }
+	if !f.Until.IsZero() { at["$lt"]  = f.Until }
+	if len(at) > 0 { filter["at"] = at }
+
+	var cur *mongo.Cursor
+	cur, err = db.audit.Find(ctx, filter,
+		mopts.Find().
+			SetSort(bson.D{{Key: "at", Value: -1}}).
+			SetSkip(skip).
+			SetLimit(limit),
+	)
+	if err != nil { return }
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var a AuditDoc
+		err = cur.Decode(&a)
+		if err != nil { return }
+		docs = append(docs, a)
+	}
+	err = cur.Err()
+	return
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// token bucket: Burst tokens at most, refilled with Rate tokens per second
+// zero Rate disables the limit
+type RateLimit struct {
+    Rate  float64 `json:"rate"`
+    Burst int     `json:"burst"`
+}
+
+func PerMinute(n int) RateLimit {
+    return RateLimit{Rate: float64(n) / 60, Burst: n}
+}
+
+func (l RateLimit) Enabled() bool {
+    return l.Rate > 0 && l.Burst > 0
+}
+
+type RateLimits struct {
+    LoginIP    RateLimit `json:"loginIP"`
+    LoginUser  RateLimit `json:"loginUser"`
+    RegisterIP RateLimit `json:"registerIP"`
+    ExprIP     RateLimit `json:"exprIP"`
+    ExprUser   RateLimit `json:"exprUser"`
+
+    MaxFailedLogins int      `json:"maxFailedLogins"` // 0 disables lockout
+    LockoutTime     Duration `json:"lockoutTime"`
+
+    // keep buckets in storage, so limits are shared between instances
+    Persistent bool `json:"persistent"`
+}
+
+func DefaultRateLimits() RateLimits {
+    return RateLimits{
+        LoginIP:    PerMinute(20),
+        LoginUser:  PerMinute(5),
+        RegisterIP: PerMinute(5),
+        ExprIP:     RateLimit{Rate: 2,  Burst: 10},
+        ExprUser:   RateLimit{Rate: 10, Burst: 30},
+
+        MaxFailedLogins: 5,
+        LockoutTime:     Duration(15 * time.Minute),
+    }
+}
+
+type bucket struct {
+    key    string
+    tokens float64
+    at     time.Time
+}
+
+// least recently used buckets are evicted above it
+const maxBuckets = 1 << 16
+
+type RateLimiter struct {
+    Name  string
+    Limit RateLimit
+    DB    *Storage // if set, buckets are kept in storage
+
+    mu      sync.Mutex
+    buckets map[string]*list.Element
+    lru     list.List // of *bucket, most recently used first
+}
+
+func (rl *RateLimiter) Allow(ctx context.Context, key string) (ok bool, retryAfter time.Duration, err error) {
+    if !rl.Limit.Enabled() { return true, 0, nil }
+    if rl.DB != nil {
+        return rl.DB.TakeToken(ctx, rl.Name + ":" + key, rl.Limit)
+    }
+
+    rl.mu.Lock()
+    defer rl.mu.Unlock()
+
+    now := time.Now()
+    if rl.buckets == nil {
+        rl.buckets = make(map[string]*list.Element)
+    }
+    var b *bucket
+    if el := rl.buckets[key]; el != nil {
+        rl.lru.MoveToFront(el)
+        b = el.Value.(*bucket)
+    } else {
+        // evicted bucket was idle longest, so it is the closest to full one
+        if len(rl.buckets) >= maxBuckets {
+            oldest := rl.lru.Back()
+            rl.lru.Remove(oldest)
+            delete(rl.buckets, oldest.Value.(*bucket).key)
+        }
+        b = &bucket{key: key, tokens: float64(rl.Limit.Burst), at: now}
+        rl.buckets[key] = rl.lru.PushFront(b)
+    }
+    b.tokens = refill(rl.Limit, b.tokens, now.Sub(b.at))
+    b.at     = now
+    if b.tokens < 1 {
+        return false, tokenWait(rl.Limit, b.tokens), nil
+    }
+    b.tokens -= 1
+    return true, 0, nil
+}
+
+func refill(l RateLimit, tokens float64, elapsed time.Duration) float64 {
+    return math.Min(float64(l.Burst), tokens + elapsed.Seconds() * l.Rate)
+}
+
+func tokenWait(l RateLimit, tokens float64) time.Duration {
+    return time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+}
+
+func (sv *Server) limiter(name string, limit RateLimit) *RateLimiter {
+    sv.limitMu.Lock()
+    defer sv.limitMu.Unlock()
+
+    if sv.limiters == nil {
+        sv.limiters = make(map[string]*RateLimiter)
+    }
+    rl := sv.limiters[name]
+    if rl == nil {
+        rl = &RateLimiter{Name: name, Limit: limit}
+        if sv.Limits.Persistent { rl.DB = sv.DB }
+        sv.limiters[name] = rl
+    }
+    return rl
+}
+
+// address of client, behind trusted proxy it is the last address of
+// X-Forwarded-For, which is appended by proxy itself
+func (sv *Server) ClientIP(r *http.Request) string {
+    if sv.TrustProxy {
+        if ip := forwardedFor(r); ip != "" { return ip }
+    }
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil { return r.RemoteAddr }
+    return host
+}
+
+func forwardedFor(r *http.Request) string {
+    values := r.Header.Values("X-Forwarded-For")
+    if len(values) == 0 { return "" }
+    addrs := strings.Split(values[len(values)-1], ",")
+    ip := net.ParseIP(strings.TrimSpace(addrs[len(addrs)-1]))
+    if ip == nil { return "" }
+    return ip.String()
+}
+
+func WriteTooManyRequests(w http.ResponseWriter, retryAfter time.Duration, msg string) {
+    secs := int64(math.Ceil(retryAfter.Seconds()))
+    if secs < 1 { secs = 1 }
+    w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+    WriteAPIError(w, http.StatusTooManyRequests, nil,
+                  "%s, retry after %ds", msg, secs)
+}
+
+// takes a token for key, writes 429 response when limit is exceeded
+func (sv *Server) allow(w http.ResponseWriter, r *http.Request,
+                        name string, limit RateLimit, key string) bool {
+    ok, retryAfter, err := sv.limiter(name, limit).Allow(r.Context(), key)
+    if err != nil {
+        WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+        return false
+    }
+    if !ok {
+        WriteTooManyRequests(w, retryAfter, "too many requests")
+        return false
+    }
+    return true
+}
+
+// per-IP rate limiting middleware
+func (sv *Server) LimitIP(name string, limit RateLimit, next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if !sv.allow(w, r, name + "-ip", limit, sv.ClientIP(r)) {
+            return
+        }
+        next(w, r)
+    }
+}
+
+type LockedError struct {
+    Until time.Time
+}
+
+func (e *LockedError) Error() string {
+    return fmt.Sprintf("account is locked until %s", e.Until.UTC().Format(time.RFC3339))
+}
+
+// VerifyUser with lockout accounting,
+// wrong password is never answered with LockedError, even when it locks account
+func (sv *Server) verifyPassword(ctx context.Context, username, password string) (ok bool, err error) {
+    ok, err = sv.DB.VerifyUser(ctx, username, password)
+    if err == nil && ok {
+        if sv.Limits.MaxFailedLogins > 0 {
+            err = sv.DB.ResetLoginFailures(ctx, username)
+        }
+        return
+    }
+    if err != nil && err != ErrInvalidPassword { return }
+    ok, err = false, nil
+    if sv.Limits.MaxFailedLogins > 0 {
+        var until time.Time
+        until, err = sv.DB.LoginFailed(ctx, username,
+                                       sv.Limits.MaxFailedLogins,
+                                       time.Duration(sv.Limits.LockoutTime))
+        if err == nil && !until.IsZero() {
+            serverLog.Warn("account locked after failed logins",
+                "username", username,
+                "until",    until)
+        }
+    }
+    return
+}
@@ -2,17 +2,25 @@ package server
 
 import (
     "context"
+    "errors"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 	"sync"
+	"sync/atomic"
     
+    "github.com/Fipaan/gosp/lexer"
     "github.com/Fipaan/gosp/parser"
 )
 
 type InterpSession struct {
     mu sync.Mutex
     gs parser.GospState
+
+    Username   string
+    CreatedAt  time.Time
+    LastUsedAt time.Time
 }
 
 type Server struct {
@@ -21,52 +29,135 @@ type Server struct {
     AuthTTL      time.Duration
     Addr         string
 
+    DBTimeout    time.Duration
+    EvalTimeout  time.Duration
+    Limits       RateLimits
+    StartedAt    time.Time
+
     stateMu sync.Mutex
     States  map[string]*InterpSession // key: authKey
+
+    // parent of all evaluation contexts, canceled on shutdown
+    evalCtx    context.Context
+    cancelEval context.CancelFunc
+
+    limitMu  sync.Mutex
+    limiters map[string]*RateLimiter
+
+    draining atomic.Bool // set on shutdown, see HandleReadyz
+
+    CORSOrigins []string      // origins allowed to call API, "*" for any
+    TrustProxy  bool          // trust X-Forwarded-Proto and X-Forwarded-For
+    HSTSMaxAge  time.Duration // zero disables Strict-Transport-Security
+
+    AuditRetention time.Duration // audit events are kept forever when zero
 }
 
 // sessions
 
-func (sv *Server) getInterpSession(authKey string) *InterpSession {
+func (sv *Server) getInterpSession(authKey, username string) *InterpSession {
     sv.stateMu.Lock()
     defer sv.stateMu.Unlock()
 
     if sv.States == nil {
         sv.States = make(map[string]*InterpSession)
     }
+    now := time.Now()
     s := sv.States[authKey]
     if s == nil {
-        s = &InterpSession{gs: parser.GospInit()}
+        s = &InterpSession{
+            gs:        parser.GospInit(),
+            Username:  username,
+            CreatedAt: now,
+        }
         sv.States[authKey] = s
     }
+    s.LastUsedAt = now
     return s
 }
 
-func (sv *Server) dropInterpSession(authKey string) {
+func (sv *Server) evalContext(r *http.Request) (context.Context, context.CancelFunc) {
+    sv.stateMu.Lock()
+    if sv.evalCtx == nil {
+        sv.evalCtx, sv.cancelEval = context.WithCancel(context.Background())
+    }
+    parent := sv.evalCtx
+    sv.stateMu.Unlock()
+
+    var ctx context.Context
+    var cancel context.CancelFunc
+    if sv.EvalTimeout > 0 {
+        ctx, cancel = context.WithTimeout(r.Context(), sv.EvalTimeout)
+    } else {
+        ctx, cancel = context.WithCancel(r.Context())
+    }
+    stop := context.AfterFunc(parent, cancel)
+    return ctx, func() {
+        stop()
+        cancel()
+    }
+}
+
+// Interrupts running evaluations, new ones are interrupted immediately.
+func (sv *Server) CancelEvaluations() {
+    sv.stateMu.Lock()
+    defer sv.stateMu.Unlock()
+    if sv.evalCtx == nil {
+        sv.evalCtx, sv.cancelEval = context.WithCancel(context.Background())
+    }
+    sv.cancelEval()
+}
+
+// Drops interpreter state of all sessions, waiting for running evaluations.
+func (sv *Server) Close() {
+    sv.stateMu.Lock()
+    states := sv.States
+    sv.States = nil
+    sv.stateMu.Unlock()
+
+    for _, s := range states {
+        s.mu.Lock()
+        s.gs = parser.GospState{}
+        s.mu.Unlock()
+    }
+}
+
+func (sv *Server) dropInterpSession(authKeys ...string) {
     sv.stateMu.Lock()
     defer sv.stateMu.Unlock()
     if sv.States != nil {
-        delete(sv.States, authKey)
+        for _, authKey := range authKeys {
+            delete(sv.States, authKey)
+        }
     }
 }
 
 // auth
 
 func (sv *Server) ExtractAuthKey(r *http.Request) string {
-	if c, err := r.Cookie(sv.CookieName); err == nil && c.Value != "" {
-		return c.Value
-	}
+	authKey, _ := sv.extractAuthKey(r)
+	return authKey
+}
+
+// Explicit header wins over cookie, fromCookie is set when cookie is used.
+func (sv *Server) extractAuthKey(r *http.Request) (authKey string, fromCookie bool) {
 	authz := r.Header.Get("Authorization")
 	if strings.HasPrefix(strings.ToLower(authz), "bearer ") {
-		return strings.TrimSpace(authz[7:])
+		if v := strings.TrimSpace(authz[7:]); v != "" {
+			return v, false
+		}
 	}
 	if v := strings.TrimSpace(r.Header.Get("X-Auth-Key")); v != "" {
-		return v
+		return v, false
+	}
+	if c, err := r.Cookie(sv.CookieName); err == nil && c.Value != "" {
+		return c.Value, true
 	}
-	return ""
+	return "", false
 }
 
-func (sv *Server) SetAuthCookie(w http.ResponseWriter, authKey string, exp time.Time) {
+func (sv *Server) SetAuthCookie(w http.ResponseWriter, r *http.Request,
+                                authKey string, exp time.Time) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     sv.CookieName,
 		Value:    authKey,
@@ -74,11 +165,12 @@ func (sv *Server) SetAuthCookie(w http.ResponseWriter, authKey string, exp time.
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
 		Expires:  exp,
-		// Secure: true, // enable behind HTTPS
+		Secure:   sv.IsSecure(r),
 	})
+	sv.setCSRFCookie(w, r, authKey, exp)
 }
 
-func (sv *Server) ClearAuthCookie(w http.ResponseWriter) {
+func (sv *Server) ClearAuthCookie(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     sv.CookieName,
 		Value:    "",
@@ -86,12 +178,23 @@ func (sv *Server) ClearAuthCookie(w http.ResponseWriter) {
 		HttpOnly: true,
 		Expires:  time.Unix(0, 0),
 		MaxAge:   -1,
+		Secure:   sv.IsSecure(r),
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:    CSRFCookieName,
+		Value:   "",
+		Path:    "/",
+		Expires: time.Unix(0, 0),
+		MaxAge:  -1,
+		Secure:  sv.IsSecure(r),
 	})
 }
 
 func (sv *Server) WithTimeout(r *http.Request) (context.Context, context.CancelFunc) {
 	// Basic request-scoped DB timeout
-	return context.WithTimeout(r.Context(), 5*time.Second)
+	timeout := sv.DBTimeout
+	if timeout <= 0 { timeout = 5*time.Second }
+	return context.WithTimeout(r.Context(), timeout)
 }
 
 func (sv *Server) HandleRegister(w http.ResponseWriter, r *http.Request) {
@@ -123,13 +226,14 @@ func (sv *Server) HandleRegister(w http.ResponseWriter, r *http.Request) {
 
 	if err := sv.DB.CreateUser(ctx, req.Username, req.Password); err != nil {
 		if err.Error() == "username already exists" {
-			WriteAPIError(w, http.StatusConflict, nil, err.Error())
+			WriteAPIError(w, http.StatusConflict, nil, "%s", err.Error())
 			return
 		}
 		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
 		return
 	}
 
+	sv.audit(r, AuditRegister, req.Username, "")
 	WriteJSON(w, http.StatusOK, map[string]string{"status": "OK"})
 }
 
@@ -153,15 +257,34 @@ func (sv *Server) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !sv.allow(w, r, "login-user", sv.Limits.LoginUser, req.Username) {
+		return
+	}
+
 	ctx, cancel := sv.WithTimeout(r)
 	defer cancel()
 
-	ok, err := sv.DB.VerifyUser(ctx, req.Username, req.Password)
+	ok, err := sv.verifyPassword(ctx, req.Username, req.Password)
+	var locked *LockedError
+	if errors.As(err, &locked) {
+		metricLogins.Inc("locked")
+		sv.audit(r, AuditLoginFailed, req.Username, "", "reason", "locked")
+		WriteTooManyRequests(w, time.Until(locked.Until), "account is temporarily locked")
+		return
+	}
+	if errors.Is(err, ErrAccountDisabled) {
+		metricLogins.Inc("disabled")
+		sv.audit(r, AuditLoginFailed, req.Username, "", "reason", "disabled")
+		WriteAPIError(w, http.StatusForbidden, nil, "account is disabled")
+		return
+	}
 	if err != nil {
 		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
 		return
 	}
 	if !ok {
+		metricLogins.Inc("invalid")
+		sv.audit(r, AuditLoginFailed, req.Username, "", "reason", "invalid")
 		WriteAPIError(w, http.StatusUnauthorized, nil, "invalid credentials")
 		return
 	}
@@ -172,24 +295,62 @@ func (sv *Server) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sv.SetAuthCookie(w, authKey, exp)
+	metricLogins.Inc("success")
+	setRequestUser(r, req.Username)
+	sv.audit(r, AuditLogin, req.Username, "")
+	sv.SetAuthCookie(w, r, authKey, exp)
 	w.Header().Set("X-Auth-Key", authKey)
 
-	WriteJSON(w, http.StatusOK, map[string]string{"status": "OK"})
+	// for cross-origin pages, which can't read CSRF cookie
+	WriteJSON(w, http.StatusOK, map[string]string{
+		"status":    "OK",
+		"csrfToken": sv.DB.CSRFToken(authKey),
+	})
+}
+
+// Resolves authKey as login session or API token.
+func (sv *Server) Authenticate(ctx context.Context, authKey string) (sess SessionDoc, ok bool, err error) {
+	if !strings.HasPrefix(authKey, TokenPrefix) {
+		return sv.DB.TouchSession(ctx, authKey)
+	}
+	tok, ok, err := sv.DB.TouchToken(ctx, authKey)
+	if err != nil || !ok { return }
+	sess = SessionDoc{
+		AuthKey:    tok.AuthKey(),
+		Username:   tok.Username,
+		CreatedAt:  tok.CreatedAt,
+		LastUsedAt: tok.LastUsedAt,
+		ExpiresAt:  tok.ExpiresAt,
+		Token:      &tok,
+	}
+	return
+}
+
+// Empty scope is full access, which scoped tokens don't have.
+func (sess *SessionDoc) HasScope(scope string) bool {
+	if sess.Token == nil || len(sess.Token.Scopes) == 0 {
+		return true
+	}
+	return scope != "" && slices.Contains(sess.Token.Scopes, scope)
 }
 
 func (sv *Server) RequireAuth(next func(w http.ResponseWriter, r *http.Request, sess SessionDoc)) http.HandlerFunc {
+	return sv.RequireScope("", next)
+}
+
+func (sv *Server) RequireScope(scope string, next func(w http.ResponseWriter, r *http.Request, sess SessionDoc)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authKey := sv.ExtractAuthKey(r)
 		if authKey == "" {
 			WriteAPIError(w, http.StatusUnauthorized, nil, "authKey is required")
 			return
 		}
+		if !sv.verifyCSRF(w, r) { return }
 
 		ctx, cancel := sv.WithTimeout(r)
 		defer cancel()
 
-		sess, ok, err := sv.DB.TouchSession(ctx, authKey)
+		sess, ok, err := sv.Authenticate(ctx, authKey)
 		if err != nil {
 			WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
 			return
@@ -198,10 +359,30 @@ func (sv *Server) RequireAuth(next func(w http.ResponseWriter, r *http.Request,
 			WriteAPIError(w, http.StatusUnauthorized, nil, "invalid or expired authKey")
 			return
 		}
+		if !sess.HasScope(scope) {
+			WriteAPIError(w, http.StatusForbidden, nil, "token has insufficient scope")
+			return
+		}
+		if _, fromCookie := sv.extractAuthKey(r); fromCookie {
+			w.Header().Set(CSRFHeader, sv.DB.CSRFToken(authKey))
+		}
+		setRequestUser(r, sess.Username)
 		next(w, r, sess)
 	}
 }
 
+// Account and its credentials are managed by login sessions only,
+// so that leaked API token can't take over the account.
+func (sv *Server) RequireSession(next func(w http.ResponseWriter, r *http.Request, sess SessionDoc)) http.HandlerFunc {
+	return sv.RequireAuth(func(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+		if sess.Token != nil {
+			WriteAPIError(w, http.StatusForbidden, nil, "login session is required, API tokens can't manage account")
+			return
+		}
+		next(w, r, sess)
+	})
+}
+
 func (sv *Server) HandleLogout(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
 	if r.Method != http.MethodPost {
 		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
@@ -213,9 +394,11 @@ func (sv *Server) HandleLogout(w http.ResponseWriter, r *http.Request, sess Sess
 		ctx, cancel := sv.WithTimeout(r)
 		defer cancel()
 		_ = sv.DB.DeleteSession(ctx, authKey)
+		sv.dropInterpSession(authKey)
 	}
+	sv.audit(r, AuditLogout, sess.Username, "")
 
-	sv.ClearAuthCookie(w)
+	sv.ClearAuthCookie(w, r)
 	WriteJSON(w, http.StatusOK, map[string]string{"status": "OK"})
 }
 
@@ -239,6 +422,64 @@ func (sv *Server) HandleHistory(w http.ResponseWriter, r *http.Request, sess Ses
 	})
 }
 
+// Authenticates request if it carries authKey, anonymous otherwise.
+// Invalid authKey is treated as anonymous.
+func (sv *Server) OptionalAuth(r *http.Request) (sess SessionDoc, ok bool) {
+    authKey := sv.ExtractAuthKey(r)
+    if authKey == "" { return }
+
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	sess, ok, err := sv.Authenticate(ctx, authKey)
+	if err != nil { ok = false }
+	if ok { setRequestUser(r, sess.Username) }
+	return
+}
+
+// Evaluates expr in workspace of sess (fresh state if nil) and records history.
+// err is set when evaluation was interrupted.
+// hook is optional, see parser.Tracer
+func (sv *Server) EvalExpr(r *http.Request, sess *SessionDoc, source, expr string,
+                           hook parser.EvalHook) (res string, firstLoc *lexer.Location, err error) {
+    var gs *parser.GospState
+
+    if sess != nil {
+        isess := sv.getInterpSession(sess.AuthKey, sess.Username)
+        isess.mu.Lock()
+        defer isess.mu.Unlock()
+        gs = &isess.gs
+    } else {
+        tmp := parser.GospInit()
+        gs = &tmp
+    }
+
+    ctx, cancel := sv.evalContext(r)
+    defer cancel()
+    gs.Ctx  = ctx
+    gs.Hook = hook
+    defer func() { gs.Ctx, gs.Hook = nil, nil }()
+
+    p := parser.ParserInit()
+    p.AddSourceNamed(source, expr)
+
+    start := time.Now()
+    res, firstLoc, err = EvalTS(&p, gs)
+    evalLog.Debug("evaluated",
+        "requestId",  RequestID(r),
+        "source",     source,
+        "durationMs", float64(time.Since(start).Microseconds()) / 1000,
+        "failed",     firstLoc != nil)
+    if firstLoc != nil { return }
+
+    if sess != nil {
+        ctx, cancel := sv.WithTimeout(r)
+		defer cancel()
+		sv.DB.AppendHistory(ctx, sess.Username, expr, res)
+    }
+    return
+}
+
 func (sv *Server) HandleExpr(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
@@ -246,21 +487,18 @@ func (sv *Server) HandleExpr(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Expr string `json:"expr"`
+		Expr  string `json:"expr"`
+		Trace bool   `json:"trace"` // record function calls
 	}
 	if !ReadJSONBody(w, r, &req) {
 		return
 	}
 
-	var username string
-    authKey := sv.ExtractAuthKey(r)
-    if authKey != "" {
-		ctx, cancel := sv.WithTimeout(r)
-		defer cancel()
-
-		if sess, ok, err := sv.DB.TouchSession(ctx, authKey); err == nil && ok {
-			username = sess.Username
-		}
+	if !sv.verifyCSRF(w, r) { return }
+	sess, authed := sv.OptionalAuth(r)
+	if authed && !sess.HasScope(ScopeEval) {
+		WriteAPIError(w, http.StatusForbidden, nil, "token has insufficient scope")
+		return
 	}
 
     req.Expr = strings.TrimSpace(req.Expr)
@@ -268,34 +506,38 @@ func (sv *Server) HandleExpr(w http.ResponseWriter, r *http.Request) {
         WriteAPIError(w, http.StatusBadRequest, nil, "expr is required")
         return
     }
-    
-    var gs *parser.GospState
-    var isess *InterpSession
 
-    if username != "" {
-        isess = sv.getInterpSession(authKey)
-        isess.mu.Lock()
-        defer isess.mu.Unlock()
-        gs = &isess.gs
+    var psess *SessionDoc
+    if authed {
+        if !sv.allow(w, r, "expr-user", sv.Limits.ExprUser, sess.Username) { return }
+        psess = &sess
     } else {
-        tmp := parser.GospInit()
-        gs = &tmp
+        if !sv.allow(w, r, "expr-ip", sv.Limits.ExprIP, sv.ClientIP(r)) { return }
     }
 
-    p := parser.ParserInit()
-    p.AddSourceNamed("post-request", req.Expr)
-
-    res, firstLoc := EvalTS(&p, gs)
+    var tracer *parser.Tracer
+    var hook parser.EvalHook
+    if req.Trace {
+        tracer = &parser.Tracer{MaxNodes: MaxTraceNodes}
+        hook = tracer
+    }
+    res, firstLoc, err := sv.EvalExpr(r, psess, "post-request", req.Expr, hook)
+    if err != nil {
+    	WriteEvalInterrupted(w, firstLoc, res, err)
+    	return
+    }
     if firstLoc != nil {
     	WriteAPIError(w, http.StatusBadRequest, firstLoc, "%s", res)
     	return
     }
 
-    if username != "" {
-        ctx, cancel := sv.WithTimeout(r)
-		defer cancel()
-		sv.DB.AppendHistory(ctx, username, req.Expr, res)
+    resp := struct {
+        Result         string              `json:"result"`
+        Trace          []*parser.TraceNode `json:"trace,omitempty"`
+        TraceTruncated bool                `json:"traceTruncated,omitempty"`
+    }{Result: res}
+    if tracer != nil {
+        resp.Trace, resp.TraceTruncated = tracer.Calls, tracer.Truncated
     }
-
-	WriteJSON(w, http.StatusOK, map[string]string{"result": res})
+	WriteJSON(w, http.StatusOK, resp)
 }
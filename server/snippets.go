@@ -0,0 +1,240 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Fipaan/gosp/parser"
+)
+
+const (
+    VisibilityUnlisted = "unlisted" // anyone with the link
+    VisibilityPrivate  = "private"  // owner only
+)
+
+const maxSnippetLen = 64 << 10
+
+type SnippetInfo struct {
+    ID         string    `json:"id"`
+    URL        string    `json:"url"`
+    Owner      string    `json:"owner"`
+    Expr       string    `json:"expr"`
+    Transcript string    `json:"transcript,omitempty"`
+    Visibility string    `json:"visibility"`
+    CreatedAt  time.Time `json:"createdAt"`
+    IsOwner    bool      `json:"isOwner"`
+}
+
+func NewSnippetInfo(sn *SnippetDoc, username string) SnippetInfo {
+    return SnippetInfo{
+        ID:         sn.ID,
+        URL:        "/s/" + sn.ID,
+        Owner:      sn.Owner,
+        Expr:       sn.Expr,
+        Transcript: sn.Transcript,
+        Visibility: sn.Visibility,
+        CreatedAt:  sn.CreatedAt,
+        IsOwner:    username != "" && sn.Owner == username,
+    }
+}
+
+func validVisibility(v string) bool {
+    return v == VisibilityUnlisted || v == VisibilityPrivate
+}
+
+func (sv *Server) HandleSnippets(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	switch r.Method {
+	case http.MethodGet:  sv.listSnippets(w, r, sess)
+	case http.MethodPost: sv.createSnippet(w, r, sess)
+	default:
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+	}
+}
+
+func (sv *Server) listSnippets(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	docs, err := sv.DB.ListSnippets(ctx, sess.Username, 100)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+
+	items := make([]SnippetInfo, 0, len(docs))
+	for i := range docs {
+		items = append(items, NewSnippetInfo(&docs[i], sess.Username))
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"items": items,
+	})
+}
+
+func (sv *Server) createSnippet(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	var req struct {
+		Expr           string `json:"expr"`
+		WithTranscript bool   `json:"withTranscript"`
+		Visibility     string `json:"visibility"`
+	}
+	if !ReadJSONBody(w, r, &req) {
+		return
+	}
+
+	req.Expr = strings.TrimSpace(req.Expr)
+	if req.Expr == "" {
+		WriteAPIError(w, http.StatusBadRequest, nil, "expr is required")
+		return
+	}
+	if len(req.Expr) > maxSnippetLen {
+		WriteAPIError(w, http.StatusBadRequest, nil, "expr too long")
+		return
+	}
+	if req.Visibility == "" {
+		req.Visibility = VisibilityUnlisted
+	}
+	if !validVisibility(req.Visibility) {
+		WriteAPIError(w, http.StatusBadRequest, nil, "unknown visibility: %s", req.Visibility)
+		return
+	}
+
+	doc := SnippetDoc{
+		Owner:      sess.Username,
+		Expr:       req.Expr,
+		Visibility: req.Visibility,
+	}
+	if req.WithTranscript {
+		if !sv.allow(w, r, "expr-user", sv.Limits.ExprUser, sess.Username) { return }
+		// evaluated in fresh state, so transcript doesn't depend on the workspace
+		gs := parser.GospInit()
+		p  := parser.ParserInit()
+		p.AddSourceNamed("snippet", req.Expr)
+		ctx, cancel := sv.evalContext(r)
+		gs.Ctx = ctx
+		doc.Transcript, _, _ = EvalTS(&p, &gs)
+		cancel()
+	}
+
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	id, err := sv.DB.CreateSnippet(ctx, doc)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+	doc.ID = id
+
+	WriteJSON(w, http.StatusOK, NewSnippetInfo(&doc, sess.Username))
+}
+
+// loads snippet visible to caller, writes error on failure
+func (sv *Server) loadSnippet(w http.ResponseWriter, r *http.Request,
+                              username string) (sn SnippetDoc, ok bool) {
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	sn, ok, err := sv.DB.GetSnippet(ctx, r.PathValue("id"))
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return sn, false
+	}
+	// private snippets don't exist for others
+	if ok && sn.Visibility == VisibilityPrivate && sn.Owner != username {
+		ok = false
+	}
+	if !ok {
+		WriteAPIError(w, http.StatusNotFound, nil, "snippet not found")
+	}
+	return
+}
+
+func (sv *Server) HandleSnippet(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var username string
+		if sess, ok := sv.OptionalAuth(r); ok {
+			username = sess.Username
+		}
+		sn, ok := sv.loadSnippet(w, r, username)
+		if !ok { return }
+		WriteJSON(w, http.StatusOK, NewSnippetInfo(&sn, username))
+	case http.MethodPatch:
+		sv.RequireAuth(sv.updateSnippet)(w, r)
+	case http.MethodDelete:
+		sv.RequireAuth(sv.deleteSnippet)(w, r)
+	default:
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+	}
+}
+
+func (sv *Server) updateSnippet(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	var req struct {
+		Visibility string `json:"visibility"`
+	}
+	if !ReadJSONBody(w, r, &req) {
+		return
+	}
+	if !validVisibility(req.Visibility) {
+		WriteAPIError(w, http.StatusBadRequest, nil, "unknown visibility: %s", req.Visibility)
+		return
+	}
+
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	ok, err := sv.DB.SetSnippetVisibility(ctx, sess.Username, r.PathValue("id"), req.Visibility)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+	if !ok {
+		WriteAPIError(w, http.StatusNotFound, nil, "snippet not found")
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "OK"})
+}
+
+func (sv *Server) deleteSnippet(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	ok, err := sv.DB.DeleteSnippet(ctx, sess.Username, r.PathValue("id"))
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+	if !ok {
+		WriteAPIError(w, http.StatusNotFound, nil, "snippet not found")
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// evaluates snippet in caller's workspace
+func (sv *Server) HandleSnippetFork(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	if r.Method != http.MethodPost {
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+		return
+	}
+
+	sn, ok := sv.loadSnippet(w, r, sess.Username)
+	if !ok { return }
+
+	if !sv.allow(w, r, "expr-user", sv.Limits.ExprUser, sess.Username) { return }
+
+	res, firstLoc, err := sv.EvalExpr(r, &sess, "snippet-" + sn.ID, sn.Expr, nil)
+	if err != nil {
+		WriteEvalInterrupted(w, firstLoc, res, err)
+		return
+	}
+	if firstLoc != nil {
+		WriteAPIError(w, http.StatusBadRequest, firstLoc, "%s", res)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{
+		"expr":   sn.Expr,
+		"result": res,
+	})
+}
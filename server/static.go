@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Serves UI files from fsys without directory listings.
+//   * ETag is hash of content, clients always revalidate with it
+//   * precompressed `name.br`/`name.gz` are served when client accepts them,
+//     text files are gzipped in memory otherwise
+//   * missing files get FallbackPage with 404 status
+type Static struct {
+    FS           fs.FS
+    Dev          bool   // files are reloaded on each request and not cached by clients
+    FallbackPage string // e.g. "404.html"
+
+    mu    sync.Mutex
+    files map[string]*staticFile
+}
+
+type staticFile struct {
+    data    []byte
+    gz      []byte // nil when not worth compressing
+    br      []byte // only precompressed
+    etag    string // hash of data, without quotes
+    ctype   string
+    modTime time.Time
+}
+
+func NewStatic(fsys fs.FS, dev bool) *Static {
+    return &Static{FS: fsys, Dev: dev, FallbackPage: "404.html"}
+}
+
+func compressible(ctype string) bool {
+    return strings.HasPrefix(ctype, "text/") ||
+           strings.Contains(ctype, "javascript") ||
+           strings.Contains(ctype, "json") ||
+           strings.Contains(ctype, "svg")
+}
+
+func gzipBytes(data []byte) []byte {
+    var b bytes.Buffer
+    zw, _ := gzip.NewWriterLevel(&b, gzip.BestCompression)
+    zw.Write(data)
+    zw.Close()
+    return b.Bytes()
+}
+
+func (st *Static) load(name string) (*staticFile, error) {
+    if !st.Dev {
+        st.mu.Lock()
+        f := st.files[name]
+        st.mu.Unlock()
+        if f != nil { return f, nil }
+    }
+
+    info, err := fs.Stat(st.FS, name)
+    if err != nil { return nil, err }
+    if info.IsDir() { return nil, fs.ErrNotExist }
+    data, err := fs.ReadFile(st.FS, name)
+    if err != nil { return nil, err }
+
+    sum := sha256.Sum256(data)
+    f := &staticFile{
+        data:    data,
+        etag:    hex.EncodeToString(sum[:8]),
+        ctype:   mime.TypeByExtension(path.Ext(name)),
+        modTime: info.ModTime(),
+    }
+    if f.ctype == "" {
+        f.ctype = http.DetectContentType(data)
+    }
+    if br, err := fs.ReadFile(st.FS, name + ".br"); err == nil {
+        f.br = br
+    }
+    if gz, err := fs.ReadFile(st.FS, name + ".gz"); err == nil {
+        f.gz = gz
+    } else if compressible(f.ctype) && len(data) > 512 {
+        if gz := gzipBytes(data); len(gz) < len(data) { f.gz = gz }
+    }
+
+    if !st.Dev {
+        st.mu.Lock()
+        if st.files == nil { st.files = make(map[string]*staticFile) }
+        st.files[name] = f
+        st.mu.Unlock()
+    }
+    return f, nil
+}
+
+func acceptsEncoding(r *http.Request, enc string) bool {
+    for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+        name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+        if strings.EqualFold(strings.TrimSpace(name), enc) {
+            return strings.ReplaceAll(params, " ", "") != "q=0"
+        }
+    }
+    return false
+}
+
+func (st *Static) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodHead {
+        WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+        return
+    }
+
+    name := strings.TrimPrefix(path.Clean("/" + r.URL.Path), "/")
+    if name == "" || strings.HasSuffix(r.URL.Path, "/") {
+        name = path.Join(name, "index.html")
+    }
+    st.ServeFile(w, r, name)
+}
+
+// serves file name of FS, regardless of request path
+func (st *Static) ServeFile(w http.ResponseWriter, r *http.Request, name string) {
+    f, err := st.load(name)
+    status := http.StatusOK
+    if errors.Is(err, fs.ErrNotExist) && st.FallbackPage != "" {
+        f, err = st.load(st.FallbackPage)
+        status = http.StatusNotFound
+    }
+    if err != nil {
+        if errors.Is(err, fs.ErrNotExist) {
+            http.NotFound(w, r)
+        } else {
+            http.Error(w, "internal server error", http.StatusInternalServerError)
+        }
+        return
+    }
+
+    h := w.Header()
+    h.Set("Content-Type", f.ctype)
+    h.Set("X-Content-Type-Options", "nosniff")
+    h.Set("Cache-Control", "no-cache") // revalidated with ETag
+
+    data, etag := f.data, f.etag
+    if f.gz != nil || f.br != nil {
+        h.Add("Vary", "Accept-Encoding")
+    }
+    switch {
+    case f.br != nil && acceptsEncoding(r, "br"):
+        data, etag = f.br, etag + "-br"
+        h.Set("Content-Encoding", "br")
+    case f.gz != nil && acceptsEncoding(r, "gzip"):
+        data, etag = f.gz, etag + "-gz"
+        h.Set("Content-Encoding", "gzip")
+    }
+
+    if status != http.StatusOK {
+        w.WriteHeader(status)
+        if r.Method != http.MethodHead { w.Write(data) }
+        return
+    }
+    h.Set("ETag", `"` + etag + `"`)
+    http.ServeContent(w, r, name, f.modTime, bytes.NewReader(data))
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+    ScopeEval        = "eval"
+    ScopeHistoryRead = "history:read"
+)
+
+var KnownScopes = []string{ScopeEval, ScopeHistoryRead}
+
+type TokenInfo struct {
+    ID         string     `json:"id"`
+    Name       string     `json:"name"`
+    Scopes     []string   `json:"scopes"`
+    CreatedAt  time.Time  `json:"createdAt"`
+    LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+    ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+func NewTokenInfo(t *TokenDoc) TokenInfo {
+    info := TokenInfo{
+        ID:        t.ID.Hex(),
+        Name:      t.Name,
+        Scopes:    t.Scopes,
+        CreatedAt: t.CreatedAt,
+    }
+    if info.Scopes == nil { info.Scopes = []string{} }
+    if !t.LastUsedAt.IsZero() { info.LastUsedAt = &t.LastUsedAt }
+    if !t.ExpiresAt.IsZero()  { info.ExpiresAt  = &t.ExpiresAt  }
+    return info
+}
+
+func (sv *Server) HandleTokens(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	switch r.Method {
+	case http.MethodGet:  sv.listTokens(w, r, sess)
+	case http.MethodPost: sv.createToken(w, r, sess)
+	default:
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+	}
+}
+
+func (sv *Server) listTokens(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	docs, err := sv.DB.ListTokens(ctx, sess.Username)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+
+	items := make([]TokenInfo, 0, len(docs))
+	for i := range docs {
+		items = append(items, NewTokenInfo(&docs[i]))
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"items": items,
+	})
+}
+
+func (sv *Server) createToken(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expiresInDays"` // 0 never expires
+	}
+	if !ReadJSONBody(w, r, &req) {
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		WriteAPIError(w, http.StatusBadRequest, nil, "name is required")
+		return
+	}
+	if len(req.Name) > 64 {
+		WriteAPIError(w, http.StatusBadRequest, nil, "name too long")
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		WriteAPIError(w, http.StatusBadRequest, nil, "expiresInDays must not be negative")
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(KnownScopes, scope) {
+			WriteAPIError(w, http.StatusBadRequest, nil, "unknown scope: %s", scope)
+			return
+		}
+	}
+
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	token, doc, err := sv.DB.CreateToken(ctx, sess.Username, req.Name, req.Scopes, ttl)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+
+	sv.audit(r, AuditTokenCreate, sess.Username, "",
+		"tokenId", doc.ID.Hex(),
+		"name",    req.Name,
+		"scopes",  strings.Join(req.Scopes, ","))
+
+	// plain token is shown only once
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"token": token,
+		"info":  NewTokenInfo(&doc),
+	})
+}
+
+func (sv *Server) HandleTokenRevoke(w http.ResponseWriter, r *http.Request, sess SessionDoc) {
+	if r.Method != http.MethodDelete {
+		WriteAPIError(w, http.StatusMethodNotAllowed, nil, "Method not allowed")
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		WriteAPIError(w, http.StatusBadRequest, nil, "invalid token id")
+		return
+	}
+
+	ctx, cancel := sv.WithTimeout(r)
+	defer cancel()
+
+	ok, err := sv.DB.DeleteToken(ctx, sess.Username, id)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, nil, "database error")
+		return
+	}
+	if !ok {
+		WriteAPIError(w, http.StatusNotFound, nil, "token not found")
+		return
+	}
+	sv.dropInterpSession((&TokenDoc{ID: id}).AuthKey())
+	sv.audit(r, AuditTokenRevoke, sess.Username, "", "tokenId", id.Hex())
+
+	WriteJSON(w, http.StatusOK, map[string]string{"status": "OK"})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"time"
+)
+
+// in-memory certificate for localhost, browsers will warn about it
+func selfSignedCert() (tls.Certificate, error) {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil { return tls.Certificate{}, err }
+
+    serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+    if err != nil { return tls.Certificate{}, err }
+
+    now  := time.Now()
+    tmpl := x509.Certificate{
+        SerialNumber: serial,
+        Subject:      pkix.Name{Organization: []string{"gosp development"}},
+        NotBefore:    now.Add(-time.Hour),
+        NotAfter:     now.Add(30 * 24 * time.Hour),
+        KeyUsage:     x509.KeyUsageDigitalSignature,
+        ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+        DNSNames:     []string{"localhost"},
+        IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+    }
+    der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+    if err != nil { return tls.Certificate{}, err }
+
+    return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}